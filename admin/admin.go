@@ -0,0 +1,178 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Scheduler is the scheduler of the pipeline.
+type Scheduler interface {
+	Pause()
+	Resume()
+	Paused() bool
+	SetInterval(d time.Duration) error
+	Interval() time.Duration
+}
+
+// Service is the notification service of the pipeline. If it implements
+// SetConcurrency(int) error, the concurrency limit can be changed.
+type Service interface {
+	InFlight() int
+	Concurrency() int
+}
+
+// concurrencySetter is implemented by Services with a resizable concurrency
+// limit.
+type concurrencySetter interface {
+	SetConcurrency(n int) error
+}
+
+// Options are the parts of the pipeline controlled by the admin API.
+type Options struct {
+	Scheduler Scheduler
+	Service   Service
+	QueueLen  func() int             // number of messages waiting to be scheduled
+	Drain     func() int             // removes the queued messages and returns their number
+	Config    map[string]interface{} // static configuration reported in the state
+}
+
+// State is the state of the pipeline reported by the admin API.
+type State struct {
+	Paused      bool                   `json:"paused"`
+	Interval    string                 `json:"interval"`
+	Rate        float64                `json:"rate"` // messages per second
+	QueueLength int                    `json:"queue_length"`
+	InFlight    int                    `json:"in_flight"`
+	Concurrency int                    `json:"concurrency"`
+	Config      map[string]interface{} `json:"config,omitempty"`
+}
+
+// NewHandler returns a Handler which serves the admin API:
+//
+//	GET  /state        reports the State
+//	POST /pause        pauses the scheduler
+//	POST /resume       resumes the scheduler
+//	POST /rate         sets the interval, e.g. {"interval": "50ms"} or {"rate": 20}
+//	POST /concurrency  sets the concurrency limit, e.g. {"concurrency": 10}
+//	POST /drain        removes the queued messages, e.g. {"drained": 42}
+//
+// Except for /drain, all endpoints respond with the State.
+func NewHandler(o Options) http.Handler {
+	h := &handler{o: o}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/state", h.method(http.MethodGet, h.state))
+	mux.HandleFunc("/pause", h.method(http.MethodPost, h.pause))
+	mux.HandleFunc("/resume", h.method(http.MethodPost, h.resume))
+	mux.HandleFunc("/rate", h.method(http.MethodPost, h.rate))
+	mux.HandleFunc("/concurrency", h.method(http.MethodPost, h.concurrency))
+	mux.HandleFunc("/drain", h.method(http.MethodPost, h.drain))
+	return mux
+}
+
+type handler struct {
+	o Options
+}
+
+// method restricts f to requests with method m.
+func (h *handler) method(m string, f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != m {
+			w.Header().Set("Allow", m)
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		f(w, r)
+	}
+}
+
+func (h *handler) state(w http.ResponseWriter, r *http.Request) {
+	interval := h.o.Scheduler.Interval()
+	writeJSON(w, http.StatusOK, State{
+		Paused:      h.o.Scheduler.Paused(),
+		Interval:    interval.String(),
+		Rate:        float64(time.Second) / float64(interval),
+		QueueLength: h.o.QueueLen(),
+		InFlight:    h.o.Service.InFlight(),
+		Concurrency: h.o.Service.Concurrency(),
+		Config:      h.o.Config,
+	})
+}
+
+func (h *handler) pause(w http.ResponseWriter, r *http.Request) {
+	h.o.Scheduler.Pause()
+	h.state(w, r)
+}
+
+func (h *handler) resume(w http.ResponseWriter, r *http.Request) {
+	h.o.Scheduler.Resume()
+	h.state(w, r)
+}
+
+func (h *handler) rate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Interval string  `json:"interval"`
+		Rate     float64 `json:"rate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var d time.Duration
+	switch {
+	case req.Interval != "" && req.Rate != 0:
+		writeError(w, http.StatusBadRequest, errors.New("either interval or rate must be set"))
+		return
+	case req.Interval != "":
+		var err error
+		if d, err = time.ParseDuration(req.Interval); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	case req.Rate > 0:
+		d = time.Duration(float64(time.Second) / req.Rate)
+	default:
+		writeError(w, http.StatusBadRequest, errors.New("interval or rate > 0 must be set"))
+		return
+	}
+	if err := h.o.Scheduler.SetInterval(d); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	h.state(w, r)
+}
+
+func (h *handler) concurrency(w http.ResponseWriter, r *http.Request) {
+	cs, ok := h.o.Service.(concurrencySetter)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("concurrency cannot be changed"))
+		return
+	}
+	var req struct {
+		Concurrency int `json:"concurrency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := cs.SetConcurrency(req.Concurrency); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	h.state(w, r)
+}
+
+func (h *handler) drain(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]int{"drained": h.o.Drain()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
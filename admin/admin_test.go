@@ -0,0 +1,186 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/admin"
+)
+
+type mockScheduler struct {
+	paused   bool
+	interval time.Duration
+}
+
+func (s *mockScheduler) Pause()                  { s.paused = true }
+func (s *mockScheduler) Resume()                 { s.paused = false }
+func (s *mockScheduler) Paused() bool            { return s.paused }
+func (s *mockScheduler) Interval() time.Duration { return s.interval }
+func (s *mockScheduler) SetInterval(d time.Duration) error {
+	if d <= 0 {
+		return errors.New("interval must be > 0")
+	}
+	s.interval = d
+	return nil
+}
+
+type mockService struct {
+	concurrency int
+}
+
+func (s *mockService) InFlight() int    { return 1 }
+func (s *mockService) Concurrency() int { return s.concurrency }
+
+type resizableService struct {
+	mockService
+}
+
+func (s *resizableService) SetConcurrency(n int) error {
+	if n < 1 {
+		return errors.New("concurrency must be > 0")
+	}
+	s.concurrency = n
+	return nil
+}
+
+var adminTests = []struct {
+	d string                            // description of test case
+	m string                            // request method
+	p string                            // request path
+	b string                            // request body
+	c int                               // expected status code
+	s func() admin.Service              // creates the service, defaults to a fixed concurrency
+	w func(t *testing.T, s admin.State) // checks the state
+}{
+	{
+		d: "expect state",
+		m: http.MethodGet,
+		p: "/state",
+		c: http.StatusOK,
+		w: func(t *testing.T, s admin.State) {
+			if want, got := 100.0, s.Rate; want != got {
+				t.Errorf("want rate %v got %v", want, got)
+			}
+			if want, got := 3, s.QueueLength; want != got {
+				t.Errorf("want queue length %d got %d", want, got)
+			}
+			if want, got := "http://localhost", s.Config["url"]; want != got {
+				t.Errorf("want config url %v got %v", want, got)
+			}
+		},
+	},
+	{
+		d: "expect paused scheduler",
+		m: http.MethodPost,
+		p: "/pause",
+		c: http.StatusOK,
+		w: func(t *testing.T, s admin.State) {
+			if !s.Paused {
+				t.Error("want paused scheduler")
+			}
+		},
+	},
+	{
+		d: "expect interval to be set",
+		m: http.MethodPost,
+		p: "/rate",
+		b: `{"interval": "50ms"}`,
+		c: http.StatusOK,
+		w: func(t *testing.T, s admin.State) {
+			if want, got := "50ms", s.Interval; want != got {
+				t.Errorf("want interval %s got %s", want, got)
+			}
+		},
+	},
+	{
+		d: "expect interval to be set by rate",
+		m: http.MethodPost,
+		p: "/rate",
+		b: `{"rate": 20}`,
+		c: http.StatusOK,
+		w: func(t *testing.T, s admin.State) {
+			if want, got := "50ms", s.Interval; want != got {
+				t.Errorf("want interval %s got %s", want, got)
+			}
+		},
+	},
+	{
+		d: "expect error for invalid interval",
+		m: http.MethodPost,
+		p: "/rate",
+		b: `{"interval": "-1s"}`,
+		c: http.StatusBadRequest,
+	},
+	{
+		d: "expect error if concurrency cannot be changed",
+		m: http.MethodPost,
+		p: "/concurrency",
+		b: `{"concurrency": 5}`,
+		c: http.StatusNotImplemented,
+	},
+	{
+		d: "expect concurrency to be set",
+		m: http.MethodPost,
+		p: "/concurrency",
+		b: `{"concurrency": 5}`,
+		c: http.StatusOK,
+		s: func() admin.Service { return &resizableService{mockService{concurrency: 10}} },
+		w: func(t *testing.T, s admin.State) {
+			if want, got := 5, s.Concurrency; want != got {
+				t.Errorf("want concurrency %d got %d", want, got)
+			}
+		},
+	},
+	{
+		d: "expect error for wrong method",
+		m: http.MethodGet,
+		p: "/pause",
+		c: http.StatusMethodNotAllowed,
+	},
+}
+
+func TestHandler(t *testing.T) {
+	for _, tc := range adminTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			var svc admin.Service = &mockService{concurrency: 10}
+			if tt.s != nil {
+				svc = tt.s()
+			}
+			h := admin.NewHandler(admin.Options{
+				Scheduler: &mockScheduler{interval: 10 * time.Millisecond},
+				Service:   svc,
+				QueueLen:  func() int { return 3 },
+				Drain:     func() int { return 3 },
+				Config:    map[string]interface{}{"url": "http://localhost"},
+			})
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.m, tt.p, strings.NewReader(tt.b)))
+			if want, got := tt.c, rec.Code; want != got {
+				t.Fatalf("want status %d got %d: %s", want, got, rec.Body.String())
+			}
+			if tt.w == nil {
+				return
+			}
+			var s admin.State
+			if err := json.NewDecoder(rec.Body).Decode(&s); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.w(t, s)
+		})
+	}
+}
+
+func TestDrain(t *testing.T) {
+	h := admin.NewHandler(admin.Options{Drain: func() int { return 3 }})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/drain", nil))
+	if want, got := `{"drained":3}`, strings.TrimSpace(rec.Body.String()); want != got {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
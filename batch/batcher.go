@@ -0,0 +1,107 @@
+package batch
+
+import (
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/rs/zerolog"
+)
+
+// Batcher groups messages into batches.
+type Batcher struct {
+	count    int           // max number of messages per batch
+	size     int           // max number of bytes per batch
+	linger   time.Duration // max time a message waits for its batch to fill up
+	sizeOf   func(m message.Message) int
+	overhead int // bytes of a batch in addition to its messages
+	logger   zerolog.Logger
+}
+
+// NewBatcher returns a reference to a Batcher. A count or size of zero means
+// no limit. A batch is sent at the latest when linger has passed since its
+// first message was received.
+func NewBatcher(count, size int, linger time.Duration, logger zerolog.Logger) *Batcher {
+	return &Batcher{
+		count:  count,
+		size:   size,
+		linger: linger,
+		sizeOf: func(m message.Message) int { return len(m.Body) },
+		logger: logger,
+	}
+}
+
+// SizeBy measures the messages of a batch with size, the number of bytes a
+// message adds to the request body, and adds overhead bytes per batch, e.g.
+// for the brackets of a JSON array. By default, a message counts with the
+// length of its body. SizeBy must be called before Run.
+func (b *Batcher) SizeBy(size func(m message.Message) int, overhead int) {
+	b.sizeOf, b.overhead = size, overhead
+}
+
+// Run reads messages from in and sends batches to an outbound channel. A batch
+// is sent when it holds count messages, when adding the next message would
+// exceed size bytes or when linger has passed. A single message exceeding size
+// is sent as a batch of one. Remaining messages are sent when the inbound
+// channel gets closed, afterwards the outbound channel is closed. Headers of
+// messages are not sent with batch requests, this is logged once.
+func (b *Batcher) Run(in chan message.Message) chan []message.Message {
+	out := make(chan []message.Message)
+	b.logger.Info().Msg("start batcher")
+	go func() {
+		defer close(out)
+		var batch []message.Message
+		var size int
+		var warned bool // about discarded headers
+		// the timer only runs while a batch is pending
+		timer := time.NewTimer(b.linger)
+		if !timer.Stop() {
+			<-timer.C
+		}
+		flush := func() {
+			// drain the timer in case it fired already
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			if len(batch) > 0 {
+				out <- batch
+			}
+			batch, size = nil, 0
+		}
+		for {
+			select {
+			case msg, ok := <-in:
+				if !ok {
+					flush()
+					b.logger.Info().Str("term", "FIN").Msg("stop batcher")
+					return
+				}
+				if msg.Body == "" {
+					continue
+				}
+				if len(msg.Headers) > 0 && !warned {
+					b.logger.Warn().Str("id", msg.ID).Msg("message headers are not sent with batches")
+					warned = true
+				}
+				n := b.sizeOf(msg)
+				if b.size > 0 && len(batch) > 0 && size+n > b.size {
+					flush()
+				}
+				if len(batch) == 0 {
+					timer.Reset(b.linger)
+					size = b.overhead
+				}
+				batch = append(batch, msg)
+				size += n
+				if b.count > 0 && len(batch) >= b.count {
+					flush()
+				}
+			case <-timer.C:
+				flush()
+			}
+		}
+	}()
+	return out
+}
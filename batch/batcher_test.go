@@ -0,0 +1,146 @@
+package batch_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/batch"
+	"github.com/fgrimme/refurbed/message"
+	"github.com/rs/zerolog"
+	"go.uber.org/goleak"
+)
+
+var batcherTests = []struct {
+	d string        // description of test case
+	c int           // max count
+	s int           // max size
+	l time.Duration // linger
+	i []string      // input messages
+	o [][]string    // expected batches
+}{
+	{
+		d: "expect batches limited by count",
+		c: 2,
+		l: time.Minute,
+		i: []string{"foo 1", "foo 2", "foo 3", "bar 1", "bar 2"},
+		o: [][]string{{"foo 1", "foo 2"}, {"foo 3", "bar 1"}, {"bar 2"}},
+	},
+	{
+		d: "expect batches limited by size",
+		s: 10,
+		l: time.Minute,
+		i: []string{"foo 1", "foo 2", "foo 3", "oversized message", "bar 1"},
+		o: [][]string{{"foo 1", "foo 2"}, {"foo 3"}, {"oversized message"}, {"bar 1"}},
+	},
+	{
+		d: "expect empty messages to be skipped",
+		c: 10,
+		l: time.Minute,
+		i: []string{"foo 1", "", "foo 2"},
+		o: [][]string{{"foo 1", "foo 2"}},
+	},
+}
+
+func TestRun(t *testing.T) {
+	// mute logger in tests
+	l := zerolog.New(ioutil.Discard)
+	log.SetOutput(l)
+
+	for _, tc := range batcherTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			in := make(chan message.Message, len(tt.i))
+			for _, msg := range tt.i {
+				in <- message.Message{Body: msg}
+			}
+			close(in)
+
+			var got [][]string
+			for b := range batch.NewBatcher(tt.c, tt.s, tt.l, l).Run(in) {
+				got = append(got, bodies(b))
+			}
+			if !reflect.DeepEqual(tt.o, got) {
+				t.Errorf("want batches\n%v\ngot\n%v", tt.o, got)
+			}
+		})
+	}
+}
+
+func TestRunLinger(t *testing.T) {
+	l := zerolog.New(ioutil.Discard)
+
+	// the batch is sent after linger, although it is not full
+	in := make(chan message.Message)
+	out := batch.NewBatcher(10, 0, 10*time.Millisecond, l).Run(in)
+	in <- message.Message{Body: "foo 1"}
+	in <- message.Message{Body: "foo 2"}
+	select {
+	case b := <-out:
+		if want, got := []string{"foo 1", "foo 2"}, bodies(b); !reflect.DeepEqual(want, got) {
+			t.Errorf("want batch %v got %v", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Error("expect batch to be sent after linger")
+	}
+	close(in)
+	if _, ok := <-out; ok {
+		t.Error("expect outbound channel to be closed")
+	}
+}
+
+func TestRunSizeBy(t *testing.T) {
+	l := zerolog.New(ioutil.Discard)
+
+	// messages count with their quotes and separator, a batch with 2 bytes of
+	// brackets, so only 2 messages fit into 20 bytes
+	in := make(chan message.Message, 3)
+	for _, msg := range []string{"foo 1", "foo 2", "foo 3"} {
+		in <- message.Message{Body: msg}
+	}
+	close(in)
+	b := batch.NewBatcher(0, 20, time.Minute, l)
+	b.SizeBy(func(m message.Message) int { return len(m.Body) + 3 }, 2)
+
+	var got [][]string
+	for batch := range b.Run(in) {
+		got = append(got, bodies(batch))
+	}
+	if want := [][]string{{"foo 1", "foo 2"}, {"foo 3"}}; !reflect.DeepEqual(want, got) {
+		t.Errorf("want batches\n%v\ngot\n%v", want, got)
+	}
+}
+
+func TestRunHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	l := zerolog.New(&buf)
+
+	in := make(chan message.Message, 2)
+	for _, id := range []string{"1", "2"} {
+		in <- message.Message{ID: id, Body: "foo " + id, Headers: map[string]string{"X-Foo": "bar"}}
+	}
+	close(in)
+	for range batch.NewBatcher(10, 0, time.Minute, l).Run(in) {
+	}
+	if want, got := 1, strings.Count(buf.String(), "headers are not sent"); want != got {
+		t.Errorf("want %d warnings about discarded headers got %d: %s", want, got, buf.String())
+	}
+}
+
+// bodies returns the bodies of the messages.
+func bodies(msgs []message.Message) []string {
+	b := make([]string, len(msgs))
+	for i, m := range msgs {
+		b[i] = m.Body
+	}
+	return b
+}
+
+// we test for leaking go routines
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
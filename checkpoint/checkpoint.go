@@ -0,0 +1,200 @@
+package checkpoint
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+// Checkpoint is the progress of a run over an input file. All messages up to
+// Offset have been acknowledged, so a resumed run continues reading there.
+type Checkpoint struct {
+	RunID  string    `json:"run_id"`
+	Input  string    `json:"input"`  // path of the input file
+	Head   string    `json:"head"`   // SHA-256 hash of the first line of the input file
+	Offset int64     `json:"offset"` // byte offset of the end of the last acknowledged line
+	Line   int       `json:"line"`   // line number of the last acknowledged line
+	Time   time.Time `json:"time"`   // time the checkpoint was taken
+}
+
+// maxHeadSize is the max number of bytes of the first line which are hashed.
+const maxHeadSize = 64 * 1024
+
+// Head returns the SHA-256 hash of the first line of the file at path. It
+// identifies the input of a checkpoint, also if lines are appended to it.
+func Head(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(io.LimitReader(f, maxHeadSize)).ReadSlice('\n')
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", err
+	}
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify checks that the file at path is the input of the checkpoint: its
+// first line must be unchanged and it must be at least as long as the
+// acknowledged part. Lines may have been appended.
+func (c Checkpoint) Verify(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Size() < c.Offset {
+		return fmt.Errorf("input is shorter than the checkpoint offset %d", c.Offset)
+	}
+	head, err := Head(path)
+	if err != nil {
+		return err
+	}
+	if head != c.Head {
+		return errors.New("first line of the input differs from the checkpoint")
+	}
+	return nil
+}
+
+// NewRunID returns a random run ID.
+func NewRunID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b) // never returns an error
+	return hex.EncodeToString(b)
+}
+
+// Load reads the checkpoint file at path.
+func Load(path string) (Checkpoint, error) {
+	var c Checkpoint
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+// Save writes the checkpoint to the file at path. The file is replaced
+// atomically, so a crash never leaves a partial checkpoint behind.
+func Save(path string, c Checkpoint) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Tracker is a result Writer which tracks the contiguous watermark of
+// acknowledged messages. Since requests complete out of order, a message
+// only advances the watermark once all messages before it are acknowledged.
+//
+// Successful messages are acknowledged. Failed messages are acknowledged only
+// if failures are kept elsewhere, e.g. in a dead-letter file. Otherwise, the
+// first failure stops the watermark for the rest of the run.
+type Tracker struct {
+	sync.Mutex
+	c             Checkpoint
+	next          int64 // sequence number of the next message of the watermark
+	pending       map[int64]message.Position
+	blocked       int64 // sequence number of the first failure, 0 if there is none
+	failuresAcked bool
+}
+
+// NewTracker returns a Tracker which continues the checkpoint c. The
+// sequence numbers of the messages of the run start at 1.
+func NewTracker(c Checkpoint, failuresAcked bool) *Tracker {
+	return &Tracker{
+		c:             c,
+		next:          1,
+		pending:       make(map[int64]message.Position),
+		failuresAcked: failuresAcked,
+	}
+}
+
+func (t *Tracker) Write(res notify.PostResult) error {
+	if res.Pos.Seq == 0 {
+		return nil // position unknown
+	}
+	t.Lock()
+	defer t.Unlock()
+	if t.blocked > 0 && res.Pos.Seq > t.blocked {
+		return nil
+	}
+	if res.Err != nil && !t.failuresAcked {
+		t.blocked = res.Pos.Seq
+		// acknowledged messages after the failure can never advance the
+		// watermark, so they are dropped
+		for seq := range t.pending {
+			if seq > t.blocked {
+				delete(t.pending, seq)
+			}
+		}
+		return nil
+	}
+	t.ack(res.Pos)
+	return nil
+}
+
+// Ack acknowledges the message at pos without a result, e.g. since it is
+// kept in a spool file to be sent by another run.
+func (t *Tracker) Ack(pos message.Position) {
+	if pos.Seq == 0 {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	if t.blocked > 0 && pos.Seq > t.blocked {
+		return
+	}
+	t.ack(pos)
+}
+
+// ack adds pos to the pending positions and advances the watermark.
+func (t *Tracker) ack(pos message.Position) {
+	t.pending[pos.Seq] = pos
+	for {
+		pos, ok := t.pending[t.next]
+		if !ok {
+			return
+		}
+		delete(t.pending, t.next)
+		t.c.Offset, t.c.Line = pos.Offset, pos.Line
+		t.next++
+	}
+}
+
+// Checkpoint returns the checkpoint of the watermark.
+func (t *Tracker) Checkpoint() Checkpoint {
+	t.Lock()
+	defer t.Unlock()
+	c := t.c
+	c.Time = time.Now()
+	return c
+}
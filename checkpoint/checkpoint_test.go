@@ -0,0 +1,192 @@
+package checkpoint_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fgrimme/refurbed/checkpoint"
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+// result returns the result of the nth message of lines with 4 bytes each.
+func result(seq int64, failed bool) notify.PostResult {
+	res := notify.PostResult{Pos: message.Position{Seq: seq, Line: int(seq), Offset: seq * 4}}
+	if failed {
+		res.Err = errors.New("failed")
+	}
+	return res
+}
+
+var trackerTests = []struct {
+	d string              // description of test case
+	r []notify.PostResult // results in order of completion
+	f bool                // failures are acknowledged
+	o int64               // expected offset
+}{
+	{
+		d: "expect no progress without results",
+	},
+	{
+		d: "expect contiguous watermark",
+		r: []notify.PostResult{result(1, false), result(2, false), result(3, false)},
+		o: 12,
+	},
+	{
+		d: "expect watermark to wait for gaps",
+		r: []notify.PostResult{result(2, false), result(3, false), result(5, false)},
+	},
+	{
+		d: "expect watermark to advance when gaps are closed",
+		r: []notify.PostResult{result(2, false), result(3, false), result(5, false), result(1, false)},
+		o: 12,
+	},
+	{
+		d: "expect watermark to stop at the first failure",
+		r: []notify.PostResult{result(1, false), result(3, false), result(2, true), result(4, false)},
+		o: 4,
+	},
+	{
+		d: "expect acknowledged failures",
+		r: []notify.PostResult{result(1, false), result(3, false), result(2, true), result(4, false)},
+		f: true,
+		o: 16,
+	},
+	{
+		d: "expect results without position to be ignored",
+		r: []notify.PostResult{{}, result(1, false)},
+		o: 4,
+	},
+}
+
+func TestTracker(t *testing.T) {
+	for _, tc := range trackerTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			tr := checkpoint.NewTracker(checkpoint.Checkpoint{RunID: "run"}, tt.f)
+			for _, res := range tt.r {
+				if err := tr.Write(res); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			c := tr.Checkpoint()
+			if want, got := tt.o, c.Offset; want != got {
+				t.Errorf("want offset %d got %d", want, got)
+			}
+			if want, got := int(tt.o/4), c.Line; want != got {
+				t.Errorf("want line %d got %d", want, got)
+			}
+			if want, got := "run", c.RunID; want != got {
+				t.Errorf("want run ID %s got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestTrackerAck(t *testing.T) {
+	tr := checkpoint.NewTracker(checkpoint.Checkpoint{}, false)
+	for _, res := range []notify.PostResult{result(1, false), result(3, false)} {
+		if err := tr.Write(res); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// the spooled message closes the gap
+	tr.Ack(result(2, false).Pos)
+	if want, got := int64(12), tr.Checkpoint().Offset; want != got {
+		t.Errorf("want offset %d got %d", want, got)
+	}
+
+	// spooled messages after a failure do not advance the watermark
+	if err := tr.Write(result(4, true)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tr.Ack(result(5, false).Pos)
+	if want, got := int64(12), tr.Checkpoint().Offset; want != got {
+		t.Errorf("want offset %d got %d", want, got)
+	}
+}
+
+var verifyTests = []struct {
+	d   string // description of test case
+	in  string // input when the checkpoint is resumed
+	err bool   // expect an error
+}{
+	{
+		d:  "expect unchanged input to be resumed",
+		in: "foo\nbar\n",
+	},
+	{
+		d:  "expect appended input to be resumed",
+		in: "foo\nbar\nbaz\n",
+	},
+	{
+		d:   "expect error for a changed first line",
+		in:  "fox\nbar\n",
+		err: true,
+	},
+	{
+		d:   "expect error for a truncated input",
+		in:  "foo\n",
+		err: true,
+	},
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "in.txt")
+	if err := ioutil.WriteFile(path, []byte("foo\nbar\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	head, err := checkpoint.Head(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := checkpoint.Checkpoint{Input: path, Head: head, Offset: 8, Line: 2}
+
+	for _, tc := range verifyTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			if err := ioutil.WriteFile(path, []byte(tt.in), 0644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want, got := tt.err, c.Verify(path) != nil; want != got {
+				t.Errorf("want error %t got %t", want, got)
+			}
+		})
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint.json")
+	want := checkpoint.Checkpoint{RunID: checkpoint.NewRunID(), Input: "in.txt", Head: "abc", Offset: 42, Line: 7}
+	for i := 0; i < 2; i++ { // the second save replaces the file
+		if err := checkpoint.Save(path, want); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	got, err := checkpoint.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want != got {
+		t.Errorf("want checkpoint %+v got %+v", want, got)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if want, got := 1, len(files); want != got {
+		t.Errorf("want %d file got %d", want, got)
+	}
+}
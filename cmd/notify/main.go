@@ -2,48 +2,222 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/fgrimme/refurbed/admin"
+	"github.com/fgrimme/refurbed/batch"
+	"github.com/fgrimme/refurbed/checkpoint"
+	"github.com/fgrimme/refurbed/config"
+	"github.com/fgrimme/refurbed/dedup"
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/metrics"
 	"github.com/fgrimme/refurbed/notify"
+	"github.com/fgrimme/refurbed/output"
+	"github.com/fgrimme/refurbed/replay"
 	"github.com/fgrimme/refurbed/scan"
 	"github.com/fgrimme/refurbed/schedule"
+	"github.com/fgrimme/refurbed/tracing"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 var (
 	version = "unknown" // will be compiled into the binary
 	service = "notify"
+)
 
+// settings are the values of the flags.
+type settings struct {
 	targetURL    string
 	concurrency  int
 	interval     time.Duration
 	timeout      time.Duration
 	printVersion bool
+	inputFormat  string
+	inputPath    string
+	configPath   string
+
+	signSecretFile string
+	signSecretEnv  string
+	signHeader     string
+	signFormat     string
+	signEncoding   string
+
+	authType       string
+	authUser       string
+	authSecretFile string
+	authSecretEnv  string
+	authTokenURL   string
+	authScopes     string
+
+	tlsOptions notify.TLSOptions
+	tlsPins    string
+
+	compression       string
+	compressThreshold int
+
+	batchCount   int
+	batchSize    int
+	batchLinger  time.Duration
+	batchFormat  string
+	batchResults string
+
+	orderKeyField string
+	orderKeyRegex string
+
+	dedupKey    string
+	dedupWindow time.Duration
+	dedupSize   int
+	dedupStore  string
+
+	validatorOptions notify.ValidatorOptions
+	successHeaders   string
+
+	bodyMode       string
+	bodyMaxSize    int64
+	bodyDecodeSize int64
+	bodyDir        string
+
+	resultHeaders string
+	headers       string
+
+	idempotencyKey    string
+	idempotencyHeader string
+
+	outputFormat      string
+	outputSplitFormat string
+	outputPath        string
+	outputSuccess     string
+	outputFailure     string
+	outputMaxSize     int64
+	outputMaxBackups  int
+	outputOrdered     bool
+	outputOrderSize   int64
+	outputOrderWait   time.Duration
+	deadLetterPath    string
+	checkpointPath    string
+	checkpointEvery   time.Duration
+	resume            bool
+	spoolPath         string
+	gracePeriod       time.Duration
+	summaryPath       string
+	metricsAddr       string
+	adminAddr         string
+	traceOutput       string
+
+	replayFailed  bool
+	replayStatus  string
+	replayClasses string
+	replaySince   string
+	replayUntil   string
+	replayIDs     string
+}
+
+// configAliases map the names of settings in config files and environment
+// variables to the flags they set, e.g. NOTIFY_CONCURRENCY sets -c.
+var configAliases = map[string]string{
+	"concurrency":   "c",
+	"interval":      "i",
+	"timeout":       "t",
+	"auth-type":     "auth",
+	"compress-type": "compress",
+	"output-path":   "output",
+}
+
+// the prefix of environment variables, e.g. NOTIFY_URL
+const envPrefix = "NOTIFY_"
+
+// errDrained is the error of messages removed from the queue by the admin API.
+var errDrained = fmt.Errorf("drained from queue: %w", context.Canceled)
+
+// exit codes
+const (
+	exitOK          = 0   // all messages were delivered
+	exitConfig      = 1   // invalid configuration, note, invalid flags exit with 2
+	exitPartial     = 3   // some messages could not be delivered
+	exitFailure     = 4   // no message could be delivered
+	exitInput       = 5   // the input could not be read or contains malformed lines
+	exitInterrupted = 130 // the run was interrupted
 )
 
 func main() {
-	flag.StringVar(&targetURL, "url", "", "target URL")
-	flag.IntVar(&concurrency, "c", 100, "max number of concurrent POST requests")
-	flag.DurationVar(&interval, "i", time.Duration(10*time.Millisecond), "notification interval in milliseconds")
-	flag.DurationVar(&timeout, "t", time.Duration(500*time.Millisecond), "request timeout in milliseconds")
-	flag.BoolVar(&printVersion, "v", false, "print version")
-	flag.Parse()
-
-	if printVersion {
+	os.Exit(run())
+}
+
+// run runs the command and returns its exit code. Deferred functions run
+// before the program exits.
+func run() int {
+	cfg := &settings{}
+
+	// `notify replay` resends entries of previous results or dead-letter files
+	// `notify config validate` checks the configuration without running
+	fs := flag.CommandLine
+	args := os.Args[1:]
+	replaying := len(args) > 0 && args[0] == "replay"
+	validating := len(args) > 1 && args[0] == "config" && args[1] == "validate"
+	switch {
+	case replaying:
+		fs = flag.NewFlagSet("replay", flag.ExitOnError)
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: %s replay [flags] [file ...]\n", os.Args[0])
+			fs.PrintDefaults()
+		}
+		args = args[1:]
+	case validating:
+		fs = flag.NewFlagSet("config validate", flag.ExitOnError)
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: %s config validate [flags]\n", os.Args[0])
+			fs.PrintDefaults()
+		}
+		args = args[2:]
+	}
+	registerFlags(fs, cfg, replaying)
+	_ = fs.Parse(args) // exits on error
+
+	if cfg.printVersion {
 		fmt.Println(version)
-		os.Exit(0)
+		return exitOK
+	}
+	if err := loadConfig(fs, cfg); err != nil {
+		fmt.Println(err)
+		return exitConfig
 	}
-	if len(targetURL) == 0 {
-		fmt.Println("no target URL specified")
-		os.Exit(1)
+	if validating {
+		return validateConfig(cfg)
 	}
+	if err := checkConfig(cfg, replaying); err != nil {
+		fmt.Println(err)
+		return exitConfig
+	}
+
+	// signals are caught before the pipeline is set up, so none of them
+	// kills the program by its default action. they are handled once the
+	// pipeline runs.
+	quit := make(chan os.Signal, 2)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
 	// we use the default log level debug and write to stderr.
 	// note, we log in (inefficient) human friendly format to console here since it
@@ -59,59 +233,1194 @@ func main() {
 		Interface("version", version).
 		Logger()
 
+	// the progress of runs over an input file is saved to a checkpoint, so
+	// a resumed run skips the acknowledged messages. the first line of the
+	// input identifies it, so a replaced input is not resumed.
+	cp := checkpoint.Checkpoint{RunID: checkpoint.NewRunID(), Input: cfg.inputPath}
+	if cfg.checkpointPath != "" {
+		head, err := checkpoint.Head(cfg.inputPath)
+		if err != nil {
+			logger.Error().Err(err).Msg("open input")
+			return exitInput
+		}
+		cp.Head = head
+	}
+	if cfg.resume {
+		c, err := checkpoint.Load(cfg.checkpointPath)
+		if err == nil && c.Input != cfg.inputPath {
+			err = fmt.Errorf("checkpoint of another input: %s", c.Input)
+		}
+		if err == nil {
+			err = c.Verify(cfg.inputPath)
+		}
+		switch {
+		case os.IsNotExist(err):
+			logger.Info().Str("path", cfg.checkpointPath).Msg("no checkpoint to resume from")
+		case err != nil:
+			logger.Error().Err(err).Str("input", cfg.inputPath).Msg("load checkpoint")
+			return exitConfig
+		default:
+			cp = c
+			logger.Info().Int64("offset", cp.Offset).Int("line", cp.Line).Msg("resume from checkpoint")
+		}
+	}
+	logger = logger.With().Str("run_id", cp.RunID).Logger()
+
+	opts, err := newClientOptions(cfg)
+	if err != nil {
+		logger.Error().Err(err).Msg("configure client")
+		return exitConfig
+	}
+	batching := cfg.batchCount > 0 || cfg.batchSize > 0
+
+	// spans of messages are exported as JSON
+	if cfg.traceOutput != "" {
+		shutdown, err := newTracerProvider(cfg.traceOutput)
+		if err != nil {
+			logger.Error().Err(err).Msg("create tracer provider")
+			return exitConfig
+		}
+		defer func() {
+			// messages still held by a stage, e.g. the queue, a key or a
+			// batch, were not sent
+			tracing.EndAll(errUnsent)
+			shutdown()
+		}()
+	}
+
+	// metrics are served once the pipeline is set up
+	var m *metrics.Metrics
+	if cfg.metricsAddr != "" {
+		m = metrics.New()
+		opts = append(opts, notify.WithMiddleware(m.Middleware))
+	}
+
 	// post messages using the provided PostClient.
-	client := notify.NewHttpClient(targetURL)
-	notifyService, err := notify.NewService(client, timeout, concurrency, logger)
+	client := notify.NewHttpClient(cfg.targetURL, opts...)
+	var notifyService *notify.Service
+	if batching {
+		notifyService, err = notify.NewBatchService(client, cfg.timeout, cfg.concurrency, logger)
+	} else {
+		notifyService, err = notify.NewService(client, cfg.timeout, cfg.concurrency, logger)
+	}
 	if err != nil {
-		logger.Error().Err(err)
-		os.Exit(1)
+		logger.Error().Err(err).Msg("create service")
+		return exitConfig
+	}
+	key, err := newKeyFunc(cfg)
+	if err != nil {
+		logger.Error().Err(err).Msg("create order key")
+		return exitConfig
+	}
+	if key != nil {
+		notifyService.OrderBy(key)
 	}
 
 	// send one message per interval
-	scheduler := schedule.NewScheduler(interval, logger)
+	scheduler := schedule.NewScheduler(cfg.interval, logger)
 
 	// the scanner reads from stdin until it reaches EOF or its Stop method is called.
 	// note, this may consume a large amount of memory which can lead to a crash of the application.
-	scanner := scan.NewScanner(os.Stdin, logger)
+	var scanner *scan.Scanner
+	in := io.Reader(os.Stdin)
+	if !replaying && cfg.inputPath != "-" {
+		f, err := os.Open(cfg.inputPath)
+		if err != nil {
+			logger.Error().Err(err).Msg("open input")
+			return exitInput
+		}
+		defer f.Close()
+		if _, err := f.Seek(cp.Offset, io.SeekStart); err != nil {
+			logger.Error().Err(err).Msg("seek input")
+			return exitInput
+		}
+		in = f
+	}
+	switch {
+	case replaying:
+		var closeInput func()
+		scanner, closeInput, err = newReplayScanner(cfg, fs.Args(), logger)
+		if err != nil {
+			logger.Error().Err(err).Msg("open replay input")
+			return exitConfig
+		}
+		defer closeInput()
+	case cfg.inputFormat == "text":
+		scanner = scan.NewScanner(in, logger)
+	case cfg.inputFormat == "jsonl":
+		scanner = scan.NewJSONScanner(in, logger)
+	default:
+		logger.Error().Str("format", cfg.inputFormat).Msg("unsupported input format")
+		return exitConfig
+	}
+	scanner.StartAt(cp.Offset, cp.Line)
 	queue, errC := scanner.Run()
-	defer close(errC)
 
 	// context is used to cancel post requests
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	// failed messages do not stop the checkpoint if they are dead-lettered.
+	// spooled messages are acknowledged, since the spool is sent by another
+	// run.
+	var tracker *checkpoint.Tracker
+	ack := func(message.Position) {}
+	if cfg.checkpointPath != "" {
+		tracker = checkpoint.NewTracker(cp, cfg.deadLetterPath != "")
+		ack = tracker.Ack
+	}
+
+	// duplicates are dropped between the queue and the scheduler. the filter
+	// learns from the results which messages were delivered, it holds
+	// duplicates of messages in flight until then.
+	var source interface {
+		IsExhausted() bool
+		Pop() message.Message
+		Drain() []message.Message
+	} = queue
+	var filter *dedup.Filter
+	dedupKey, err := newDedupKey(cfg)
+	if err != nil {
+		logger.Error().Err(err).Msg("create dedup key")
+		return exitConfig
+	}
+	if dedupKey != nil {
+		filter = dedup.NewFilter(queue, dedupKey, cfg.dedupWindow, cfg.dedupSize)
+		if cfg.dedupStore != "" {
+			l, err := dedup.OpenLog(cfg.dedupStore, cfg.dedupWindow)
+			if err != nil {
+				logger.Error().Err(err).Msg("open dedup store")
+				return exitConfig
+			}
+			defer l.Close()
+			filter.Persist(l)
+		}
+		source = filter
+	}
+
+	// messages which are not sent before the shutdown are spooled
+	spool := newSpool(cfg.spoolPath, ack, logger)
+
+	// we catch SIGINT and SIGTERM to drain the pipeline. queued messages are
+	// sent until the grace period expires, then requests are canceled. a
+	// second signal spools the queue and exits at once.
+	done := make(chan struct{}) // closed when all results are written
+	sd := &shutdown{
+		stopScanner:   scanner.Stop,
+		stopScheduler: scheduler.Stop,
+		cancel:        func() { cancel(errShutdown) },
+		drainQueue:    source.Drain,
+		spool:         spool,
+		exit: func() {
+			// the checkpoint includes the spooled messages
+			if tracker != nil {
+				if err := checkpoint.Save(cfg.checkpointPath, tracker.Checkpoint()); err != nil {
+					logger.Error().Err(err).Msg("save checkpoint")
+				}
+			}
+			os.Exit(exitInterrupted)
+		},
+		gracePeriod: cfg.gracePeriod,
+		logger:      logger,
+	}
+	go sd.run(quit, done)
 
-	// we catch interrupts to handle termination gracefully
+	// we reload the configuration on SIGHUP. the rate limit, concurrency,
+	// headers, credentials and certificates are replaced without a restart, so
+	// queued messages are kept. if the configuration is invalid, the old one
+	// is kept.
+	current := config.Snapshot(fs)
+	auth, err := newAuthKey(cfg)
+	if err != nil {
+		logger.Error().Err(err).Msg("configure client")
+		return exitConfig
+	}
 	go func() {
-		quit := make(chan os.Signal, 1)
-		signal.Notify(quit, os.Interrupt, syscall.SIGINT)
-
-		<-quit
-		// stop reading from stdin
-		scanner.Stop()
-		// stop sending messages to the notification service
-		scheduler.Stop()
-		// cancel POST requests
-		cancel()
+		for range hup {
+			next, nextCfg, err := reloadConfig(args, replaying)
+			if err != nil {
+				logger.Error().Err(err).Msg("reload configuration")
+				continue
+			}
+			values := config.Snapshot(next)
+			changed, err := applyConfig(nextCfg, config.Changed(current, values), &auth, client, scheduler, notifyService, logger)
+			if err != nil {
+				logger.Error().Err(err).Msg("reload configuration")
+				continue
+			}
+			// settings which require a restart keep their running value, so
+			// they are reported again by the next reload
+			for _, name := range changed {
+				current[name] = values[name]
+			}
+			logger.Info().Strs("changed", changed).Msg("reloaded configuration")
+		}
 	}()
 
+	// results are written to stdout or files
+	results, closeOutput, err := newOutput(cfg, sd, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("open output")
+		return exitConfig
+	}
+	defer closeOutput()
+	collector := output.NewCollector()
+	results = output.Multi{results, collector}
+
+	if tracker != nil {
+		if cfg.spoolPath != "" {
+			results = output.Multi{results, unspooled{tracker, sd}}
+		} else {
+			results = output.Multi{results, tracker}
+		}
+		stop := saveCheckpoints(cfg.checkpointPath, cfg.checkpointEvery, tracker, logger)
+		defer stop()
+	}
+
+	if filter != nil {
+		results = output.Multi{results, filter}
+	}
+
+	if m != nil {
+		m.Observe(metrics.Sources{
+			QueueDepth:  queue.Len,
+			Emitted:     scheduler.Emitted,
+			InFlight:    notifyService.InFlight,
+			Concurrency: notifyService.Concurrency,
+		})
+		results = output.Multi{results, m}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m.Handler())
+		srv := &http.Server{Addr: cfg.metricsAddr, Handler: mux}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error().Err(err).Msg("serve metrics")
+			}
+		}()
+		defer srv.Close()
+		logger.Info().Str("addr", cfg.metricsAddr).Msg("serve metrics")
+	}
+
+	// the admin API controls the pipeline at runtime. drained messages are
+	// reported as failed results, so they can be replayed.
+	synced := &output.Synced{W: results}
+	if filter != nil {
+		filter.OnDuplicate(func(msg message.Message) {
+			tracing.End(msg, nil)
+			err := synced.Write(notify.PostResult{
+				ID:         msg.ID,
+				Msg:        msg.Body,
+				MsgHeaders: msg.Headers,
+				URL:        cfg.targetURL,
+				Duplicate:  true,
+				Pos:        msg.Pos,
+			})
+			if err != nil {
+				logger.Error().Err(err).Msg("write result")
+			}
+		})
+	}
+	if cfg.adminAddr != "" {
+		drain := func() int {
+			msgs := queue.Drain()
+			for _, msg := range msgs {
+				tracing.End(msg, errDrained)
+				err := synced.Write(notify.PostResult{
+					ID:         msg.ID,
+					Msg:        msg.Body,
+					MsgHeaders: msg.Headers,
+					URL:        cfg.targetURL,
+					Err:        errDrained,
+					Pos:        msg.Pos,
+				})
+				if err != nil {
+					logger.Error().Err(err).Msg("write result")
+				}
+			}
+			logger.Info().Int("drained", len(msgs)).Msg("drain queue")
+			return len(msgs)
+		}
+		srv := &http.Server{Addr: cfg.adminAddr, Handler: admin.NewHandler(admin.Options{
+			Scheduler: scheduler,
+			Service:   notifyService,
+			QueueLen:  queue.Len,
+			Drain:     drain,
+			Config: map[string]interface{}{
+				"url":           cfg.targetURL,
+				"timeout":       cfg.timeout.String(),
+				"batch_count":   cfg.batchCount,
+				"batch_size":    cfg.batchSize,
+				"compression":   cfg.compression,
+				"output_format": cfg.outputFormat,
+			},
+		})}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error().Err(err).Msg("serve admin API")
+			}
+		}()
+		defer srv.Close()
+		logger.Info().Str("addr", cfg.adminAddr).Msg("serve admin API")
+	}
+
 	// wait until all requests have returned, also in case of SIGINT
 	// this way we ensure to shutdown gracefully always
-	resCh := notifyService.Run(ctx, scheduler.Run(queue))
-	for res := range resCh {
-		// results will be logged to stdout
-		if err := json.NewEncoder(os.Stdout).Encode(res); err != nil {
-			logger.Error().Err(err)
-			continue
+	var resCh chan notify.PostResult
+	if batching {
+		batcher := batch.NewBatcher(cfg.batchCount, cfg.batchSize, cfg.batchLinger, logger)
+		// the format was validated with the client options already
+		encoder, _ := notify.NewBatchEncoder(cfg.batchFormat, cfg.batchResults)
+		batcher.SizeBy(encoder.Size, encoder.Overhead())
+		resCh = notifyService.RunBatches(ctx, batcher.Run(scheduler.Run(source)))
+	} else {
+		resCh = notifyService.Run(ctx, scheduler.Run(source))
+	}
+	unsent := writeResults(resCh, synced, sd, logger)
+	close(done)
+	spool(append(unsent, source.Drain()...))
+
+	// the scanner may still be blocked reading stdin after an interrupt, so we
+	// only wait for its error if it reached EOF
+	var inputErr error
+	if !sd.Interrupted() {
+		if inputErr = <-errC; inputErr != nil {
+			logger.Error().Err(inputErr).Msg("read input")
+		}
+	}
+
+	summary := collector.Summary()
+	summary.Read, summary.Malformed = scanner.Read(), scanner.Malformed()
+	logger.Info().
+		Int("read", summary.Read).
+		Int("malformed", summary.Malformed).
+		Int("sent", summary.Sent).
+		Int("succeeded", summary.Succeeded).
+		Int("failed", summary.Failed).
+		Int("duplicates", summary.Duplicates).
+		Interface("failed_by_class", summary.FailedByClass).
+		Interface("failed_by_status", summary.FailedByStatus).
+		Int("retries", summary.Retries).
+		Float64("p50_ms", summary.Latency.P50).
+		Float64("p95_ms", summary.Latency.P95).
+		Float64("p99_ms", summary.Latency.P99).
+		Float64("throughput", summary.Throughput).
+		Float64("duration_s", summary.Duration).
+		Msg("summary")
+	if cfg.summaryPath != "" {
+		if err := writeSummary(cfg.summaryPath, summary); err != nil {
+			logger.Error().Err(err).Msg("write summary")
 		}
 	}
 
-	// check for scanner error
-	if err := <-errC; err == nil {
-		logger.Error().Err(err)
-		// note, Exit does not run deferred functions
-		// so we need to cancel the context and close channels
-		cancel()
-		close(errC)
-		os.Exit(1)
+	switch {
+	case sd.Interrupted():
+		return exitInterrupted
+	case inputErr != nil || summary.Malformed > 0:
+		return exitInput
+	case summary.Failed > 0 && summary.Succeeded == 0:
+		return exitFailure
+	case summary.Failed > 0:
+		return exitPartial
+	}
+	return exitOK
+}
+
+// writeResults writes the results to w until the channel is closed. The
+// messages of requests canceled by the shutdown are returned to be spooled.
+func writeResults(results <-chan notify.PostResult, w output.Writer, sd *shutdown, logger zerolog.Logger) []message.Message {
+	var unsent []message.Message
+	for res := range results {
+		if sd.unsent(res) {
+			unsent = append(unsent, message.Message{ID: res.ID, Body: res.Msg, Headers: res.MsgHeaders, Pos: res.Pos})
+		}
+		if err := w.Write(res); err != nil {
+			logger.Error().Err(err).Msg("write result")
+		}
+	}
+	return unsent
+}
+
+// saveCheckpoints saves the checkpoint of the tracker to the file at path
+// once per interval. The returned function stops saving and saves the last
+// checkpoint.
+func saveCheckpoints(path string, interval time.Duration, tracker *checkpoint.Tracker, logger zerolog.Logger) func() {
+	save := func() {
+		if err := checkpoint.Save(path, tracker.Checkpoint()); err != nil {
+			logger.Error().Err(err).Msg("save checkpoint")
+		}
+	}
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				save()
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+		save()
+		c := tracker.Checkpoint()
+		logger.Info().Int64("offset", c.Offset).Int("line", c.Line).Msg("save checkpoint")
+	}
+}
+
+// newTracerProvider registers a TracerProvider which exports spans to the file
+// at path, or to stdout for -. Trace context is propagated in W3C traceparent
+// headers. The returned function flushes the remaining spans and closes the
+// file.
+func newTracerProvider(path string) (func(), error) {
+	w := io.WriteCloser(os.Stdout)
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	exp, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", service),
+			attribute.String("service.version", version),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return func() {
+		_ = tp.Shutdown(context.Background())
+		if w != os.Stdout {
+			w.Close()
+		}
+	}, nil
+}
+
+// writeSummary writes the JSON encoded summary to the file at path.
+func writeSummary(path string, s output.Summary) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// registerFlags registers the flags of the command.
+func registerFlags(fs *flag.FlagSet, cfg *settings, replaying bool) {
+	if replaying {
+		replayFlags(fs, cfg)
+	} else {
+		inputFlags(fs, cfg)
+	}
+	commonFlags(fs, cfg)
+}
+
+// inputFlags registers the flags of commands reading new messages.
+func inputFlags(fs *flag.FlagSet, cfg *settings) {
+	fs.StringVar(&cfg.inputFormat, "input-format", "text", "format of the input [text|jsonl]")
+	fs.StringVar(&cfg.inputPath, "input", "-", "file to read messages from, - means stdin")
+	fs.StringVar(&cfg.checkpointPath, "checkpoint", "", "file to save the progress of the run over the -input file to")
+	fs.DurationVar(&cfg.checkpointEvery, "checkpoint-interval", 5*time.Second, "interval between checkpoints")
+	fs.BoolVar(&cfg.resume, "resume", false, "skip the messages acknowledged by the -checkpoint of a previous run")
+}
+
+// commonFlags registers the flags shared by all commands.
+func commonFlags(fs *flag.FlagSet, cfg *settings) {
+	fs.StringVar(&cfg.targetURL, "url", "", "target URL")
+	fs.IntVar(&cfg.concurrency, "c", 100, "max number of concurrent POST requests")
+	fs.DurationVar(&cfg.interval, "i", time.Duration(10*time.Millisecond), "notification interval in milliseconds")
+	fs.DurationVar(&cfg.timeout, "t", time.Duration(500*time.Millisecond), "request timeout in milliseconds")
+	fs.BoolVar(&cfg.printVersion, "v", false, "print version")
+	fs.StringVar(&cfg.configPath, "config", "", "YAML config file, settings are overridden by environment variables and flags")
+	fs.StringVar(&cfg.signSecretFile, "sign-secret-file", "", "file containing the HMAC signing secret")
+	fs.StringVar(&cfg.signSecretEnv, "sign-secret-env", "", "environment variable containing the HMAC signing secret")
+	fs.StringVar(&cfg.signHeader, "sign-header", notify.DefaultSignatureHeader, "name of the signature header")
+	fs.StringVar(&cfg.signFormat, "sign-format", notify.FormatStripe, "signature header format [stripe|github]")
+	fs.StringVar(&cfg.signEncoding, "sign-encoding", notify.EncodingHex, "signature encoding [hex|base64]")
+	fs.StringVar(&cfg.authType, "auth", "", "authentication type [bearer|basic|oauth2]")
+	fs.StringVar(&cfg.authUser, "auth-user", "", "basic auth username or OAuth2 client ID")
+	fs.StringVar(&cfg.authSecretFile, "auth-secret-file", "", "file containing the bearer token, basic auth password or OAuth2 client secret")
+	fs.StringVar(&cfg.authSecretEnv, "auth-secret-env", "", "environment variable containing the bearer token, basic auth password or OAuth2 client secret")
+	fs.StringVar(&cfg.authTokenURL, "auth-token-url", "", "OAuth2 token endpoint")
+	fs.StringVar(&cfg.authScopes, "auth-scopes", "", "comma separated list of OAuth2 scopes")
+	fs.StringVar(&cfg.tlsOptions.CAFile, "tls-ca", "", "PEM encoded CA bundle to verify the receiver")
+	fs.StringVar(&cfg.tlsOptions.CertFile, "tls-cert", "", "PEM encoded client certificate")
+	fs.StringVar(&cfg.tlsOptions.KeyFile, "tls-key", "", "PEM encoded client key")
+	fs.StringVar(&cfg.tlsOptions.MinVersion, "tls-min-version", "1.2", "minimum TLS version [1.0|1.1|1.2|1.3]")
+	fs.StringVar(&cfg.tlsOptions.ServerName, "tls-server-name", "", "server name used to verify the receiver's certificate")
+	fs.StringVar(&cfg.tlsPins, "tls-pins", "", "comma separated list of base64 encoded SHA-256 public key (SPKI) pins")
+	fs.StringVar(&cfg.compression, "compress", "", "request body compression [gzip|deflate|zstd]")
+	fs.IntVar(&cfg.compressThreshold, "compress-threshold", 1024, "min body size in bytes for compression")
+	fs.IntVar(&cfg.batchCount, "batch-count", 0, "max number of messages per batch request, batching is disabled if count and size are 0")
+	fs.IntVar(&cfg.batchSize, "batch-size", 0, "max number of bytes of the request body of a batch, before compression")
+	fs.DurationVar(&cfg.batchLinger, "batch-linger", time.Duration(100*time.Millisecond), "max time to wait for a batch to fill up")
+	fs.StringVar(&cfg.batchFormat, "batch-format", notify.BatchJSON, "request body format of batches [json|ndjson|text]")
+	fs.StringVar(&cfg.batchResults, "batch-results", notify.BatchResultsAll, "mapping of batch responses to message results [all|items]")
+	fs.StringVar(&cfg.orderKeyField, "order-key-field", "", "JSONPath of the message body field messages are ordered by, e.g. '$.order.id'")
+	fs.StringVar(&cfg.orderKeyRegex, "order-key-regex", "", "regular expression whose first capture group messages are ordered by")
+	fs.StringVar(&cfg.dedupKey, "dedup-key", "", "key of duplicate messages which are dropped, body for the hash of the body or a JSONPath, e.g. '$.event.id'")
+	fs.DurationVar(&cfg.dedupWindow, "dedup-window", time.Hour, "time a key is remembered, 0 means forever")
+	fs.IntVar(&cfg.dedupSize, "dedup-size", 100000, "max number of keys remembered in memory, 0 means no limit")
+	fs.StringVar(&cfg.dedupStore, "dedup-store", "", "file to persist the keys of delivered messages to, so duplicates are dropped across runs")
+	fs.StringVar(&cfg.validatorOptions.Statuses, "success-status", "200-299", "comma separated list of accepted status codes or ranges")
+	fs.StringVar(&cfg.validatorOptions.BodyRegex, "success-body-regex", "", "regular expression the response body must match")
+	fs.StringVar(&cfg.validatorOptions.JSONPath, "success-jsonpath", "", "JSONPath assertion on the response body, e.g. '$.ok == true'")
+	fs.StringVar(&cfg.successHeaders, "success-headers", "", "comma separated list of required response headers")
+	fs.StringVar(&cfg.bodyMode, "body-mode", notify.BodyKeep, "response body capture [keep|discard-success|file]")
+	fs.Int64Var(&cfg.bodyMaxSize, "body-max-size", 64*1024, "max number of response body bytes kept in a result, 0 means no limit")
+	fs.Int64Var(&cfg.bodyDecodeSize, "body-decode-max-size", 16*1024*1024, "max number of response body bytes read for -success-body-regex, -success-jsonpath and -batch-results=items, 0 means no limit")
+	fs.StringVar(&cfg.bodyDir, "body-dir", "", "directory to save response bodies to with -body-mode=file")
+	fs.StringVar(&cfg.headers, "headers", "", "comma separated list of static request headers, e.g. 'X-Source: notify'")
+	fs.StringVar(&cfg.idempotencyKey, "idempotency-key", "", "source of the idempotency key sent with each request [id|hash]")
+	fs.StringVar(&cfg.idempotencyHeader, "idempotency-header", notify.DefaultIdempotencyHeader, "name of the idempotency key header")
+	fs.StringVar(&cfg.resultHeaders, "result-headers", "", "comma separated list of response headers to include in the results")
+	fs.StringVar(&cfg.outputFormat, "output-format", output.FormatNDJSON, "format of the results [ndjson|csv|table|quiet]")
+	fs.StringVar(&cfg.outputPath, "output", "-", "file to write results to, - means stdout")
+	fs.StringVar(&cfg.outputSplitFormat, "output-split-format", "", "format of -output-success and -output-failure, defaults to -output-format")
+	fs.StringVar(&cfg.outputSuccess, "output-success", "", "additional file to write successful results to")
+	fs.StringVar(&cfg.outputFailure, "output-failure", "", "additional file to write failed results to")
+	fs.Int64Var(&cfg.outputMaxSize, "output-max-size", 0, "max size of output files in bytes before they are rotated, 0 means no rotation")
+	fs.IntVar(&cfg.outputMaxBackups, "output-max-backups", 5, "max number of rotated output files to keep")
+	fs.BoolVar(&cfg.outputOrdered, "output-ordered", false, "write results in input order instead of completion order")
+	fs.Int64Var(&cfg.outputOrderSize, "output-order-max-size", 64*1024*1024, "max number of bytes of results buffered by -output-ordered, 0 means no limit")
+	fs.DurationVar(&cfg.outputOrderWait, "output-order-max-wait", 10*time.Second, "max time a missing result may hold back the results of -output-ordered, 0 means no limit")
+	fs.StringVar(&cfg.traceOutput, "trace-output", "", "file to export OpenTelemetry spans to as JSON, - means stdout")
+	fs.StringVar(&cfg.adminAddr, "admin-addr", "", "address to serve the admin API on, e.g. localhost:9091")
+	fs.StringVar(&cfg.metricsAddr, "metrics-addr", "", "address to serve Prometheus metrics on at /metrics, e.g. :9090")
+	fs.StringVar(&cfg.summaryPath, "summary", "", "file to write the JSON encoded summary of the run to")
+	fs.StringVar(&cfg.deadLetterPath, "dead-letter", "", "file to append messages to which could not be delivered")
+	fs.StringVar(&cfg.spoolPath, "spool", "", "file to append queued messages to which were not sent before the shutdown")
+	fs.DurationVar(&cfg.gracePeriod, "grace-period", 10*time.Second, "time to send queued messages after SIGINT or SIGTERM before requests are canceled")
+}
+
+// loadConfig sets the flags of fs which are not set on the command line from
+// the config file and environment variables. Environment variables override
+// the config file.
+func loadConfig(fs *flag.FlagSet, cfg *settings) error {
+	path := cfg.configPath
+	if path == "" {
+		path = os.Getenv(config.EnvName(envPrefix, "config"))
+	}
+	file := config.Values{}
+	if path != "" {
+		var err error
+		if file, err = config.Load(path); err != nil {
+			return err
+		}
+	}
+	env := config.Env(fs, configAliases, envPrefix, os.LookupEnv)
+	return config.Apply(fs, configAliases, file, env)
+}
+
+// checkConfig reports invalid settings which are not checked when the parts of
+// the pipeline are created.
+func checkConfig(cfg *settings, replaying bool) error {
+	var errs []error
+	if len(cfg.targetURL) == 0 {
+		errs = append(errs, errors.New("no target URL specified"))
+	}
+	if cfg.concurrency < 1 {
+		errs = append(errs, errors.New("concurrency must be > 0"))
+	}
+	if cfg.interval <= 0 {
+		errs = append(errs, errors.New("interval must be > 0"))
+	}
+	if !replaying && cfg.inputFormat != "text" && cfg.inputFormat != "jsonl" {
+		errs = append(errs, fmt.Errorf("unsupported input format: %s", cfg.inputFormat))
+	}
+	if cfg.checkpointPath != "" && cfg.inputPath == "-" {
+		errs = append(errs, errors.New("checkpoints require an -input file"))
+	}
+	if cfg.checkpointPath != "" && cfg.checkpointEvery <= 0 {
+		errs = append(errs, errors.New("checkpoint interval must be > 0"))
+	}
+	if cfg.resume && cfg.checkpointPath == "" {
+		errs = append(errs, errors.New("no checkpoint to resume from specified"))
+	}
+	if cfg.orderKeyField != "" && cfg.orderKeyRegex != "" {
+		errs = append(errs, errors.New("only one of -order-key-field and -order-key-regex can be specified"))
+	}
+	if (cfg.orderKeyField != "" || cfg.orderKeyRegex != "") && (cfg.batchCount > 0 || cfg.batchSize > 0) {
+		errs = append(errs, errors.New("ordered delivery is not supported with batching"))
+	}
+	if cfg.dedupWindow < 0 {
+		errs = append(errs, errors.New("dedup window must be >= 0"))
+	}
+	if cfg.dedupSize < 0 {
+		errs = append(errs, errors.New("dedup size must be >= 0"))
+	}
+	if cfg.dedupStore != "" && cfg.dedupKey == "" {
+		errs = append(errs, errors.New("no -dedup-key for the dedup store specified"))
+	}
+	if !replaying && cfg.inputFormat == "text" && cfg.idempotencyKey == notify.KeyFromID {
+		// line numbers repeat across files and runs, so they would collide
+		errs = append(errs, errors.New("idempotency keys from message IDs require -input-format=jsonl"))
+	}
+	if cfg.traceOutput == "-" && (cfg.outputPath == "-" || cfg.outputSuccess == "-" || cfg.outputFailure == "-") {
+		errs = append(errs, errors.New("spans and results cannot both be written to stdout"))
+	}
+	if cfg.outputOrderSize < 0 {
+		errs = append(errs, errors.New("output order max size must be >= 0"))
+	}
+	if cfg.outputOrderWait < 0 {
+		errs = append(errs, errors.New("output order max wait must be >= 0"))
+	}
+	if _, err := output.NewWriter(cfg.outputFormat, ioutil.Discard); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.outputSplitFormat != "" {
+		if _, err := output.NewWriter(cfg.outputSplitFormat, ioutil.Discard); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.outputSuccess != "" && splitFormat(cfg) == output.FormatQuiet {
+		errs = append(errs, errors.New("quiet output format writes no successful results to -output-success, set -output-split-format"))
+	}
+	return errors.Join(errs...)
+}
+
+// validateConfig reports all errors of the configuration without running the
+// pipeline.
+func validateConfig(cfg *settings) int {
+	errs := []error{checkConfig(cfg, false)}
+	if _, err := newClientOptions(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := newKeyFunc(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := newDedupKey(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		fmt.Println(err)
+		return exitConfig
+	}
+	fmt.Println("configuration is valid")
+	return exitOK
+}
+
+// newKeyFunc creates the KeyFunc of ordered delivery from the order flags. It
+// returns nil if messages are not ordered.
+func newKeyFunc(cfg *settings) (notify.KeyFunc, error) {
+	switch {
+	case cfg.orderKeyField != "":
+		key, err := notify.JSONKey(cfg.orderKeyField)
+		if err != nil {
+			return nil, fmt.Errorf("invalid order key field: %v", err)
+		}
+		return key, nil
+	case cfg.orderKeyRegex != "":
+		key, err := notify.RegexKey(cfg.orderKeyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid order key regex: %v", err)
+		}
+		return key, nil
+	}
+	return nil, nil
+}
+
+// newDedupKey creates the KeyFunc of message deduplication from the dedup
+// flags. It returns nil if messages are not deduplicated.
+func newDedupKey(cfg *settings) (notify.KeyFunc, error) {
+	switch cfg.dedupKey {
+	case "":
+		return nil, nil
+	case "body":
+		return dedup.BodyHash, nil
+	}
+	key, err := notify.JSONKey(cfg.dedupKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dedup key: %v", err)
+	}
+	return key, nil
+}
+
+// replayFlags registers the flags of the replay command.
+func replayFlags(fs *flag.FlagSet, cfg *settings) {
+	fs.BoolVar(&cfg.replayFailed, "failed", false, "replay failed entries only")
+	fs.StringVar(&cfg.replayStatus, "status", "", "comma separated list of status codes of entries to replay")
+	fs.StringVar(&cfg.replayClasses, "error-class", "", "comma separated list of error classes of entries to replay")
+	fs.StringVar(&cfg.replaySince, "since", "", "replay entries at or after the RFC 3339 time")
+	fs.StringVar(&cfg.replayUntil, "until", "", "replay entries before the RFC 3339 time")
+	fs.StringVar(&cfg.replayIDs, "ids", "", "comma separated list of message IDs to replay")
+}
+
+// newReplayFilter creates a Filter from the replay flags.
+func newReplayFilter(cfg *settings) (replay.Filter, error) {
+	f := replay.Filter{FailedOnly: cfg.replayFailed}
+	if cfg.replayStatus != "" {
+		for _, s := range splitList(cfg.replayStatus) {
+			code, err := strconv.Atoi(s)
+			if err != nil {
+				return f, fmt.Errorf("invalid status code: %s", s)
+			}
+			f.StatusCodes = append(f.StatusCodes, code)
+		}
+	}
+	if cfg.replayClasses != "" {
+		f.Classes = splitList(cfg.replayClasses)
+	}
+	var err error
+	if cfg.replaySince != "" {
+		if f.Since, err = time.Parse(time.RFC3339, cfg.replaySince); err != nil {
+			return f, err
+		}
+	}
+	if cfg.replayUntil != "" {
+		if f.Until, err = time.Parse(time.RFC3339, cfg.replayUntil); err != nil {
+			return f, err
+		}
+	}
+	if cfg.replayIDs != "" {
+		f.IDs = make(map[string]bool)
+		for _, id := range splitList(cfg.replayIDs) {
+			f.IDs[id] = true
+		}
+	}
+	return f, nil
+}
+
+// newReplayScanner creates a Scanner which reads the entries selected by the
+// replay flags from the files, or from stdin if there are none. The returned
+// function closes the files.
+func newReplayScanner(cfg *settings, files []string, logger zerolog.Logger) (*scan.Scanner, func(), error) {
+	filter, err := newReplayFilter(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		readers []io.Reader
+		closers []io.Closer
+	)
+	closeFiles := func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+		readers, closers = append(readers, f), append(closers, f)
+	}
+	// each file is scanned separately, so a file without a trailing newline
+	// does not merge its last line with the first line of the next file
+	if len(readers) == 0 {
+		readers = []io.Reader{os.Stdin}
+	}
+	return scan.NewMultiScanner(readers, replay.Parser(filter), logger), closeFiles, nil
+}
+
+// newOutput creates the result Writer from the output flags. The returned
+// function writes the results held back by -output-ordered and closes all
+// output files. With a spool file, the messages of requests canceled by the
+// shutdown of sd are spooled, so they are kept out of the failure and
+// dead-letter files.
+func newOutput(cfg *settings, sd *shutdown, logger zerolog.Logger) (output.Writer, func(), error) {
+	var files []io.Closer
+	var ordered *output.Ordered
+	closeFiles := func() {
+		if ordered != nil {
+			if err := ordered.Flush(); err != nil {
+				logger.Error().Err(err).Msg("write result")
+			}
+			if n := ordered.Skipped(); n > 0 {
+				logger.Warn().Int("skipped", n).Msg("missing results skipped in ordered output")
+			}
+		}
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	open := func(path, format string) (output.Writer, error) {
+		if path == "-" {
+			return output.NewWriter(format, os.Stdout)
+		}
+		f, err := output.OpenRotatingFile(path, cfg.outputMaxSize, cfg.outputMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		return output.NewWriter(format, f)
+	}
+
+	all, err := open(cfg.outputPath, cfg.outputFormat)
+	if err != nil {
+		closeFiles()
+		return nil, nil, err
+	}
+	var split output.Split
+	if cfg.outputSuccess != "" {
+		if split.Success, err = open(cfg.outputSuccess, splitFormat(cfg)); err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+	}
+	if cfg.outputFailure != "" {
+		if split.Failure, err = open(cfg.outputFailure, splitFormat(cfg)); err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+		if cfg.spoolPath != "" {
+			split.Failure = unspooled{split.Failure, sd}
+		}
+	}
+	out := output.Multi{all, split}
+	if cfg.outputOrdered {
+		// dead letters are not held back, so they are written even if the
+		// run is quit
+		ordered = output.NewOrdered(out, cfg.outputOrderSize, cfg.outputOrderWait)
+		out = output.Multi{ordered}
+	}
+	if cfg.deadLetterPath != "" {
+		// dead letters are appended and never rotated, so no failure is lost
+		f, err := output.OpenRotatingFile(cfg.deadLetterPath, 0, 0)
+		if err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+		files = append(files, f)
+		dl := output.Writer(output.NewDeadLetterWriter(f))
+		if cfg.spoolPath != "" {
+			dl = unspooled{dl, sd}
+		}
+		out = append(out, dl)
+	}
+	return out, closeFiles, nil
+}
+
+// splitFormat returns the format of the -output-success and -output-failure
+// files.
+func splitFormat(cfg *settings) string {
+	if cfg.outputSplitFormat != "" {
+		return cfg.outputSplitFormat
+	}
+	return cfg.outputFormat
+}
+
+// newAuthenticator creates an Authenticator from the auth flags.
+func newAuthenticator(cfg *settings) (notify.Authenticator, error) {
+	secret, err := notify.ReadSecret(cfg.authSecretFile, cfg.authSecretEnv)
+	if err != nil {
+		return nil, fmt.Errorf("read auth secret: %v", err)
+	}
+	switch cfg.authType {
+	case "bearer":
+		return notify.BearerToken(secret), nil
+	case "basic":
+		return notify.BasicAuth{Username: cfg.authUser, Password: string(secret)}, nil
+	case "oauth2":
+		if cfg.authTokenURL == "" {
+			return nil, errors.New("no OAuth2 token URL specified")
+		}
+		var scopes []string
+		if cfg.authScopes != "" {
+			scopes = splitList(cfg.authScopes)
+		}
+		client, err := newTokenClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return notify.NewClientCredentials(client, cfg.authTokenURL, cfg.authUser, string(secret), scopes), nil
+	default:
+		return nil, fmt.Errorf("unsupported auth type: %s", cfg.authType)
+	}
+}
+
+// newTokenClient creates the client of OAuth2 token requests. The token
+// server is verified with the CA bundle and is presented the client
+// certificate of the TLS flags, the pins and the server name only apply to
+// the receiver.
+func newTokenClient(cfg *settings) (*http.Client, error) {
+	opts := cfg.tlsOptions
+	opts.ServerName, opts.Pins = "", nil
+	tlsConfig, err := opts.Config()
+	if err != nil {
+		return nil, fmt.Errorf("load TLS configuration: %v", err)
+	}
+	return notify.NewTokenClient(tlsConfig, cfg.timeout), nil
+}
+
+// newAuthKey returns a digest of the auth settings and the secret, which
+// identifies the Authenticator created from them. It is empty without
+// authentication.
+func newAuthKey(cfg *settings) (string, error) {
+	if cfg.authType == "" {
+		return "", nil
+	}
+	secret, err := notify.ReadSecret(cfg.authSecretFile, cfg.authSecretEnv)
+	if err != nil {
+		return "", fmt.Errorf("read auth secret: %v", err)
+	}
+	h := sha256.New()
+	for _, s := range []string{cfg.authType, cfg.authUser, cfg.authTokenURL, cfg.authScopes, string(secret)} {
+		// the length prefix keeps the fields apart
+		fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// newClientOptions creates the options of the HttpClient from the flags.
+func newClientOptions(cfg *settings) ([]notify.ClientOption, error) {
+	// sign requests if a secret is provided
+	var opts []notify.ClientOption
+	signer, err := newSigner(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if signer != nil {
+		opts = append(opts, notify.WithSigner(signer))
+	}
+
+	// authenticate requests
+	if cfg.authType != "" {
+		auth, err := newAuthenticator(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("create authenticator: %v", err)
+		}
+		opts = append(opts, notify.WithAuth(auth))
+	}
+
+	// compress large request bodies
+	if cfg.compression != "" {
+		compressor, err := notify.NewCompressor(cfg.compression, cfg.compressThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("create compressor: %v", err)
+		}
+		opts = append(opts, notify.WithCompression(compressor))
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, notify.WithTLSConfig(tlsConfig))
+
+	// static request headers
+	headers, err := parseHeaders(cfg.headers)
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) > 0 {
+		opts = append(opts, notify.WithHeaders(headers))
+	}
+
+	// receivers can detect messages they received before
+	if cfg.idempotencyKey != "" {
+		idempotency, err := notify.NewIdempotency(cfg.idempotencyHeader, cfg.idempotencyKey)
+		if err != nil {
+			return nil, fmt.Errorf("create idempotency: %v", err)
+		}
+		opts = append(opts, notify.WithIdempotency(idempotency))
+	}
+
+	// success criteria of responses
+	if cfg.successHeaders != "" {
+		cfg.validatorOptions.Headers = splitList(cfg.successHeaders)
+	}
+	validator, err := notify.NewValidator(cfg.validatorOptions)
+	if err != nil {
+		return nil, fmt.Errorf("create validator: %v", err)
+	}
+	opts = append(opts, notify.WithValidator(validator))
+
+	// limit the memory used by response bodies
+	bodyCapture, err := notify.NewBodyCapture(cfg.bodyMode, cfg.bodyMaxSize, cfg.bodyDecodeSize, cfg.bodyDir)
+	if err != nil {
+		return nil, fmt.Errorf("create body capture: %v", err)
+	}
+	opts = append(opts, notify.WithBodyCapture(bodyCapture))
+
+	if cfg.resultHeaders != "" {
+		opts = append(opts, notify.WithResultHeaders(splitList(cfg.resultHeaders)...))
+	}
+
+	// pack multiple messages into a single request
+	if cfg.batchCount > 0 || cfg.batchSize > 0 {
+		encoder, err := notify.NewBatchEncoder(cfg.batchFormat, cfg.batchResults)
+		if err != nil {
+			return nil, fmt.Errorf("create batch encoder: %v", err)
+		}
+		opts = append(opts, notify.WithBatchEncoder(encoder))
+	}
+	return opts, nil
+}
+
+// newSigner creates the Signer from the signing flags. It returns nil if no
+// secret is provided.
+func newSigner(cfg *settings) (*notify.Signer, error) {
+	if cfg.signSecretFile == "" && cfg.signSecretEnv == "" {
+		return nil, nil
+	}
+	secret, err := notify.ReadSecret(cfg.signSecretFile, cfg.signSecretEnv)
+	if err != nil {
+		return nil, fmt.Errorf("read signing secret: %v", err)
+	}
+	signer, err := notify.NewSigner(secret, cfg.signHeader, cfg.signFormat, cfg.signEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("create signer: %v", err)
+	}
+	return signer, nil
+}
+
+// newTLSConfig loads the TLS configuration from the TLS flags.
+func newTLSConfig(cfg *settings) (*tls.Config, error) {
+	if cfg.tlsPins != "" {
+		cfg.tlsOptions.Pins = splitList(cfg.tlsPins)
+	}
+	tlsConfig, err := cfg.tlsOptions.Config()
+	if err != nil {
+		return nil, fmt.Errorf("load TLS configuration: %v", err)
+	}
+	return tlsConfig, nil
+}
+
+// splitList splits a comma separated list of a flag, e.g. "a, b". Spaces
+// around the items are trimmed and empty items are skipped.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseHeaders parses a comma separated list of headers, e.g.
+// "X-Source: notify,X-Env: prod".
+func parseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	if s == "" {
+		return headers, nil
+	}
+	for _, h := range strings.Split(s, ",") {
+		parts := strings.SplitN(h, ":", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("invalid header: %s", h)
+		}
+		headers[name] = strings.TrimSpace(parts[1])
+	}
+	return headers, nil
+}
+
+// reloadConfig parses the command line arguments, the config file and the
+// environment variables again. The settings are checked like at startup.
+func reloadConfig(args []string, replaying bool) (*flag.FlagSet, *settings, error) {
+	cfg := &settings{}
+	fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	registerFlags(fs, cfg, replaying)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if err := loadConfig(fs, cfg); err != nil {
+		return nil, nil, err
+	}
+	if err := checkConfig(cfg, replaying); err != nil {
+		return nil, nil, err
+	}
+	return fs, cfg, nil
+}
+
+// reloadable are the flags which are applied by applyConfig, other flags
+// require a restart.
+var reloadable = map[string]bool{
+	"i": true, "c": true, "headers": true,
+	"auth": true, "auth-user": true, "auth-secret-file": true, "auth-secret-env": true,
+	"auth-token-url": true, "auth-scopes": true,
+	"sign-secret-file": true, "sign-secret-env": true, "sign-header": true,
+	"sign-format": true, "sign-encoding": true,
+	"tls-ca": true, "tls-cert": true, "tls-key": true, "tls-min-version": true,
+	"tls-server-name": true, "tls-pins": true,
+}
+
+// applyConfig applies the reloadable settings of cfg to the running pipeline
+// and returns the names of the changed flags which were applied. Credentials
+// and certificates are reloaded even if their flags did not change, so
+// rotated secret files are picked up. The Authenticator is only replaced if
+// its settings or secret differ from authKey, so a cached OAuth2 token is
+// kept; authKey is updated then. Nothing is applied if the settings are
+// invalid.
+func applyConfig(cfg *settings, changed []string, authKey *string, client *notify.HttpClient, scheduler *schedule.Scheduler, service *notify.Service, logger zerolog.Logger) ([]string, error) {
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := newSigner(cfg)
+	if err != nil {
+		return nil, err
+	}
+	key, err := newAuthKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var auth notify.Authenticator
+	if key != *authKey && cfg.authType != "" {
+		if auth, err = newAuthenticator(cfg); err != nil {
+			return nil, fmt.Errorf("create authenticator: %v", err)
+		}
+	}
+	// a kept OAuth2 Authenticator requests tokens with the reloaded TLS
+	// configuration
+	var tokenClient *http.Client
+	if key == *authKey && cfg.authType == "oauth2" {
+		if tokenClient, err = newTokenClient(cfg); err != nil {
+			return nil, err
+		}
+	}
+	headers, err := parseHeaders(cfg.headers)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.SetTLSConfig(tlsConfig); err != nil {
+		return nil, err
+	}
+	client.SetSigner(signer)
+	if key != *authKey {
+		client.SetAuth(auth)
+		*authKey = key
+	} else if cc, ok := client.Auth().(*notify.ClientCredentials); ok && tokenClient != nil {
+		cc.SetClient(tokenClient)
+	}
+	client.SetHeaders(headers)
+
+	var applied []string
+	for _, name := range changed {
+		if !reloadable[name] {
+			logger.Warn().Str("flag", name).Msg("setting requires a restart")
+			continue
+		}
+		applied = append(applied, name)
+	}
+	// the rate and concurrency may have been changed by the admin API, so
+	// they are only set if they changed in the configuration
+	for _, name := range applied {
+		switch name {
+		case "i":
+			if err := scheduler.SetInterval(cfg.interval); err != nil {
+				logger.Error().Err(err).Msg("set interval")
+			}
+		case "c":
+			if err := service.SetConcurrency(cfg.concurrency); err != nil {
+				logger.Error().Err(err).Msg("set concurrency")
+			}
+		}
 	}
+	return applied, nil
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewReplayFilter(t *testing.T) {
+	cfg := &settings{
+		replayIDs:     "a, b,",
+		replayClasses: " timeout ,http_status",
+		replayStatus:  "500, 503",
+	}
+	f, err := newReplayFilter(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := map[string]bool{"a": true, "b": true}, f.IDs; !reflect.DeepEqual(want, got) {
+		t.Errorf("want ids %v got %v", want, got)
+	}
+	if want, got := []string{"timeout", "http_status"}, f.Classes; !reflect.DeepEqual(want, got) {
+		t.Errorf("want classes %v got %v", want, got)
+	}
+	if want, got := []int{500, 503}, f.StatusCodes; !reflect.DeepEqual(want, got) {
+		t.Errorf("want status codes %v got %v", want, got)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/fgrimme/refurbed/schedule"
+	"github.com/rs/zerolog"
+)
+
+func TestApplyConfigAuth(t *testing.T) {
+	// the token server issues numbered tokens
+	var (
+		mu     sync.Mutex
+		issued int
+	)
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		issued++
+		n := issued
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token%d","expires_in":3600}`, n)
+	}))
+	defer tokenSrv.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.New(ioutil.Discard)
+	client := notify.NewHttpClient(srv.URL)
+	service, err := notify.NewService(client, time.Second, 1, l)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := &settings{authType: "oauth2", authUser: "client", authSecretFile: secret, authTokenURL: tokenSrv.URL}
+	var authKey string
+
+	var reloadTests = []struct {
+		d string // description of test case
+		s string // secret in the file, if it is rotated
+		n int    // expected number of issued tokens
+	}{
+		{d: "expect token of new authenticator", n: 1},
+		{d: "expect cached token to be kept if nothing changed", n: 1},
+		{d: "expect new token if the secret was rotated", s: "bar", n: 2},
+	}
+	for _, tt := range reloadTests {
+		if tt.s != "" {
+			if err := ioutil.WriteFile(secret, []byte(tt.s), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := applyConfig(cfg, nil, &authKey, client, schedule.NewScheduler(time.Millisecond, l), service, l); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.d, err)
+		}
+		if res := client.Post(context.Background(), message.Message{Body: "foo"}); res.Err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.d, res.Err)
+		}
+		mu.Lock()
+		n := issued
+		mu.Unlock()
+		if want, got := tt.n, n; want != got {
+			t.Errorf("%s: want %d tokens issued got %d", tt.d, want, got)
+		}
+	}
+}
+
+func TestApplyConfigTokenTLS(t *testing.T) {
+	// the token server is signed by a CA which is only trusted after a reload
+	tokenSrv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"token","expires_in":3600}`)
+	}))
+	tokenSrv.Config.ErrorLog = log.New(ioutil.Discard, "", 0) // handshake errors
+	tokenSrv.StartTLS()
+	defer tokenSrv.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ca := filepath.Join(dir, "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tokenSrv.Certificate().Raw})
+	if err := ioutil.WriteFile(ca, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.New(ioutil.Discard)
+	client := notify.NewHttpClient(srv.URL)
+	service, err := notify.NewService(client, time.Second, 1, l)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := &settings{authType: "oauth2", authUser: "client", authSecretFile: secret, authTokenURL: tokenSrv.URL, timeout: time.Second}
+	var authKey string
+	for _, tt := range []struct {
+		d   string // description of test case
+		ca  string // CA bundle
+		err bool   // expect error
+	}{
+		{d: "expect unknown authority of the token server", err: true},
+		{d: "expect token server to be verified with the CA bundle", ca: ca},
+	} {
+		cfg.tlsOptions.CAFile = tt.ca
+		if _, err := applyConfig(cfg, nil, &authKey, client, schedule.NewScheduler(time.Millisecond, l), service, l); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.d, err)
+		}
+		res := client.Post(context.Background(), message.Message{Body: "foo"})
+		if want, got := tt.err, res.Err != nil; want != got {
+			t.Errorf("%s: want error %t got %v", tt.d, want, res.Err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/fgrimme/refurbed/output"
+	"github.com/fgrimme/refurbed/tracing"
+	"github.com/rs/zerolog"
+)
+
+// errUnsent is the error of messages which were not sent before the shutdown.
+var errUnsent = errors.New("not sent before shutdown")
+
+// errShutdown is the cause of requests canceled by the shutdown.
+var errShutdown = errors.New("canceled by shutdown")
+
+// shutdown drains the pipeline on SIGINT and SIGTERM.
+type shutdown struct {
+	stopScanner   func()                   // stops reading the input
+	stopScheduler func()                   // stops sending queued messages
+	cancel        func()                   // cancels requests in flight with errShutdown
+	drainQueue    func() []message.Message // removes the queued messages
+	spool         func(msgs []message.Message)
+	exit          func() // exits the program on the second signal
+	gracePeriod   time.Duration
+	logger        zerolog.Logger
+
+	stopScheduling sync.Once
+	interrupted    int32 // set on the first signal
+	forced         int32 // set on the second signal
+}
+
+// run handles the signals of sig until done is closed. On the first signal,
+// the input is no longer read and queued messages are sent until the grace
+// period expires. Then, the scheduler is stopped and requests are canceled.
+// The messages of canceled requests are spooled as their results return, see
+// unsent. A second signal spools the queued messages and exits at once, the
+// results of requests in flight are not written.
+func (s *shutdown) run(sig <-chan os.Signal, done <-chan struct{}) {
+	var v os.Signal
+	select {
+	case <-done:
+		return
+	case v = <-sig:
+	}
+	atomic.StoreInt32(&s.interrupted, 1)
+	s.logger.Info().Str("signal", v.String()).Dur("grace_period", s.gracePeriod).Msg("drain pipeline")
+	s.stopScanner()
+
+	grace := time.NewTimer(s.gracePeriod)
+	defer grace.Stop()
+	select {
+	case <-done:
+		return
+	case <-sig:
+		s.force()
+		return
+	case <-grace.C:
+		s.logger.Warn().Msg("grace period expired")
+	}
+	s.stop()
+
+	select {
+	case <-done:
+	case <-sig:
+		s.force()
+	}
+}
+
+// stop stops the scheduler and cancels requests in flight.
+func (s *shutdown) stop() {
+	s.stopScheduling.Do(s.stopScheduler)
+	s.cancel()
+}
+
+// force spools the queued messages and exits. The scheduler is stopped
+// first, so no queued message is sent after it was spooled.
+func (s *shutdown) force() {
+	s.logger.Warn().Msg("force quit")
+	atomic.StoreInt32(&s.forced, 1)
+	s.stopScheduling.Do(s.stopScheduler)
+	s.spool(s.drainQueue())
+	s.exit()
+}
+
+// Interrupted reports whether a signal was received.
+func (s *shutdown) Interrupted() bool {
+	return atomic.LoadInt32(&s.interrupted) == 1
+}
+
+// Forced reports whether a second signal was received.
+func (s *shutdown) Forced() bool {
+	return atomic.LoadInt32(&s.forced) == 1
+}
+
+// unsent reports whether res is the result of a request which was canceled
+// by the shutdown, so its message belongs into the spool. Other canceled
+// results, e.g. of messages drained by the admin API, are not.
+func (s *shutdown) unsent(res notify.PostResult) bool {
+	return s.Interrupted() && errors.Is(res.Err, errShutdown)
+}
+
+// unspooled is a result Writer which skips the results of canceled requests
+// if their messages are spooled. The spool acknowledges them instead.
+type unspooled struct {
+	output.Writer
+	sd *shutdown
+}
+
+func (w unspooled) Write(res notify.PostResult) error {
+	if w.sd.unsent(res) {
+		return nil
+	}
+	return w.Writer.Write(res)
+}
+
+// newSpool returns a function which appends messages to the file at path in
+// the jsonl input format, so they can be sent by another run. Without a path,
+// the number of discarded messages is logged. The positions of spooled
+// messages are passed to ack, since they are no longer sent by this run.
+func newSpool(path string, ack func(pos message.Position), logger zerolog.Logger) func(msgs []message.Message) {
+	var mu sync.Mutex // the spool is written by the results loop and on shutdown
+	return func(msgs []message.Message) {
+		if len(msgs) == 0 {
+			return
+		}
+		for _, msg := range msgs {
+			tracing.End(msg, errUnsent)
+		}
+		if path == "" {
+			logger.Warn().Int("messages", len(msgs)).Msg("discard unsent messages, no spool file specified")
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err := writeSpool(path, msgs); err != nil {
+			logger.Error().Err(err).Int("messages", len(msgs)).Msg("write spool")
+			return
+		}
+		for _, msg := range msgs {
+			ack(msg.Pos)
+		}
+		logger.Info().Int("messages", len(msgs)).Str("path", path).Msg("spool unsent messages")
+	}
+}
+
+// writeSpool appends the JSON encoded messages to the file at path.
+func writeSpool(path string, msgs []message.Message) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, msg := range msgs {
+		if err := enc.Encode(msg); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
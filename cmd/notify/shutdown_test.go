@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/fgrimme/refurbed/output"
+	"github.com/fgrimme/refurbed/scan"
+	"github.com/rs/zerolog"
+)
+
+// calls records the calls of a shutdown to the pipeline.
+type calls struct {
+	sync.Mutex
+	names   []string
+	spooled []message.Message
+}
+
+func (c *calls) call(name string) func() {
+	return func() {
+		c.Lock()
+		defer c.Unlock()
+		c.names = append(c.names, name)
+	}
+}
+
+func (c *calls) get() []string {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string(nil), c.names...)
+}
+
+var shutdownTests = []struct {
+	d string        // description of test case
+	s int           // number of signals
+	g time.Duration // grace period
+	w []string      // expected calls
+	f bool          // expect force quit
+}{
+	{
+		d: "expect nothing without signal",
+	},
+	{
+		d: "expect pipeline to drain within the grace period",
+		s: 1,
+		g: time.Hour,
+		w: []string{"stop scanner"},
+	},
+	{
+		d: "expect requests to be canceled after the grace period",
+		s: 1,
+		g: time.Millisecond,
+		w: []string{"stop scanner", "stop scheduler", "cancel"},
+	},
+	{
+		d: "expect second signal to spool the queue and exit",
+		s: 2,
+		g: time.Hour,
+		w: []string{"stop scanner", "stop scheduler", "spool", "exit"},
+		f: true,
+	},
+}
+
+func TestShutdown(t *testing.T) {
+	for _, tc := range shutdownTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			c := &calls{}
+			queued := []message.Message{{ID: "1", Body: "foo"}}
+			sd := &shutdown{
+				stopScanner:   c.call("stop scanner"),
+				stopScheduler: c.call("stop scheduler"),
+				cancel:        c.call("cancel"),
+				drainQueue:    func() []message.Message { return queued },
+				spool: func(msgs []message.Message) {
+					c.call("spool")()
+					c.spooled = append(c.spooled, msgs...)
+				},
+				exit:        c.call("exit"),
+				gracePeriod: tt.g,
+				logger:      zerolog.New(ioutil.Discard),
+			}
+			sig := make(chan os.Signal, 2)
+			done := make(chan struct{})
+			finished := make(chan struct{})
+			go func() {
+				sd.run(sig, done)
+				close(finished)
+			}()
+			for i := 0; i < tt.s; i++ {
+				sig <- os.Interrupt
+			}
+			// wait until the calls are made, then the pipeline is done
+			deadline := time.Now().Add(time.Second)
+			for len(c.get()) < len(tt.w) && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			close(done)
+			<-finished
+
+			if want, got := tt.w, c.get(); !reflect.DeepEqual(want, got) {
+				t.Errorf("want calls %v got %v", want, got)
+			}
+			if want, got := tt.s > 0, sd.Interrupted(); want != got {
+				t.Errorf("want interrupted %v got %v", want, got)
+			}
+			if want, got := tt.f, sd.Forced(); want != got {
+				t.Errorf("want forced %v got %v", want, got)
+			}
+			if tt.f && !reflect.DeepEqual(queued, c.spooled) {
+				t.Errorf("want spooled %v got %v", queued, c.spooled)
+			}
+		})
+	}
+}
+
+func TestShutdownForceAfterGracePeriod(t *testing.T) {
+	c := &calls{}
+	sd := &shutdown{
+		stopScanner:   c.call("stop scanner"),
+		stopScheduler: c.call("stop scheduler"),
+		cancel:        c.call("cancel"),
+		drainQueue:    func() []message.Message { return nil },
+		spool:         func(msgs []message.Message) { c.call("spool")() },
+		exit:          c.call("exit"),
+		gracePeriod:   time.Millisecond,
+		logger:        zerolog.New(ioutil.Discard),
+	}
+	sig := make(chan os.Signal, 2)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		sd.run(sig, done)
+		close(finished)
+	}()
+	sig <- os.Interrupt
+	for len(c.get()) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	sig <- os.Interrupt
+	<-finished
+	close(done)
+
+	// the scheduler is stopped only once
+	want := []string{"stop scanner", "stop scheduler", "cancel", "spool", "exit"}
+	if got := c.get(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want calls %v got %v", want, got)
+	}
+	if !sd.Forced() {
+		t.Error("expected force quit")
+	}
+}
+
+func TestUnsent(t *testing.T) {
+	sd := &shutdown{}
+	canceled := notify.PostResult{Err: fmt.Errorf("%w: %w", errShutdown, context.Canceled)}
+	if sd.unsent(canceled) {
+		t.Error("unexpected unsent result before a signal")
+	}
+	sd.interrupted = 1
+	if !sd.unsent(canceled) {
+		t.Error("expected canceled result to be unsent")
+	}
+	if sd.unsent(notify.PostResult{Err: context.DeadlineExceeded}) {
+		t.Error("unexpected unsent result for a timeout")
+	}
+	if sd.unsent(notify.PostResult{Err: errDrained}) {
+		t.Error("unexpected unsent result for a drained message")
+	}
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "spool.jsonl")
+	msgs := []message.Message{
+		{ID: "a", Body: "foo", Headers: map[string]string{"X-Foo": "bar"}, Pos: message.Position{Seq: 1}},
+		{ID: "b", Body: "bar", Pos: message.Position{Seq: 2}},
+	}
+	var acked []message.Position
+	spool := newSpool(path, func(pos message.Position) { acked = append(acked, pos) }, zerolog.New(ioutil.Discard))
+	spool(msgs[:1])
+	spool(msgs[1:]) // the spool is appended to
+
+	// spooled messages are acknowledged
+	if want, got := []message.Position{msgs[0].Pos, msgs[1].Pos}, acked; !reflect.DeepEqual(want, got) {
+		t.Errorf("want acknowledged positions %v got %v", want, got)
+	}
+
+	// the spool is read back as JSON Lines input
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	s := scan.NewJSONScanner(f, zerolog.New(ioutil.Discard))
+	q, errC := s.Run()
+	if err := <-errC; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range msgs {
+		got := q.Pop()
+		got.Pos = want.Pos
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("want message %+v got %+v", want, got)
+		}
+	}
+}
+
+// outputClient is a mock client which fails messages with the body fail and
+// blocks messages with the body hang until they are canceled.
+type outputClient struct{}
+
+func (outputClient) Post(ctx context.Context, m message.Message) notify.PostResult {
+	res := notify.PostResult{ID: m.ID, Msg: m.Body, Pos: m.Pos}
+	switch m.Body {
+	case "fail":
+		res.Err = errors.New("failed")
+	case "hang":
+		<-ctx.Done()
+		res.Err = ctx.Err()
+	}
+	return res
+}
+
+// readIDs returns the IDs of the JSON Lines file at path.
+func readIDs(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	var ids []string
+	dec := json.NewDecoder(f)
+	for {
+		var v struct {
+			ID string `json:"id"`
+		}
+		if err := dec.Decode(&v); err == io.EOF {
+			return ids
+		} else if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids = append(ids, v.ID)
+	}
+}
+
+func TestShutdownOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shutdown")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := &settings{
+		outputFormat:   output.FormatNDJSON,
+		outputPath:     filepath.Join(dir, "results.jsonl"),
+		outputFailure:  filepath.Join(dir, "failed.jsonl"),
+		deadLetterPath: filepath.Join(dir, "dead-letters.jsonl"),
+		spoolPath:      filepath.Join(dir, "spool.jsonl"),
+	}
+	logger := zerolog.New(ioutil.Discard)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	sd := &shutdown{
+		stopScanner:   func() {},
+		stopScheduler: func() {},
+		cancel:        func() { cancel(errShutdown) },
+		drainQueue:    func() []message.Message { return nil },
+		gracePeriod:   time.Millisecond,
+		logger:        logger,
+	}
+	sd.spool = newSpool(cfg.spoolPath, func(message.Position) {}, logger)
+	w, closeOutput, err := newOutput(cfg, sd, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s, err := notify.NewService(outputClient{}, time.Minute, 3, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	queue := make(chan message.Message, 3)
+	for i, body := range []string{"ok", "fail", "hang"} {
+		queue <- message.Message{ID: body, Body: body, Pos: message.Position{Seq: int64(i + 1)}}
+	}
+	close(queue)
+	resCh := s.Run(ctx, queue)
+
+	// the signal cancels the hanging request after the grace period
+	sig := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		sd.run(sig, done)
+		close(finished)
+	}()
+	sig <- os.Interrupt
+	unsent := writeResults(resCh, w, sd, logger)
+	close(done)
+	<-finished
+	sd.spool(unsent)
+	closeOutput()
+
+	// each failed message is written to exactly one of the files
+	tests := []struct {
+		path string
+		ids  []string
+	}{
+		{cfg.outputFailure, []string{"fail"}},
+		{cfg.deadLetterPath, []string{"fail"}},
+		{cfg.spoolPath, []string{"hang"}},
+	}
+	for _, tt := range tests {
+		if want, got := tt.ids, readIDs(t, tt.path); !reflect.DeepEqual(want, got) {
+			t.Errorf("want IDs %v in %s got %v", want, filepath.Base(tt.path), got)
+		}
+	}
+	if want, got := 3, len(readIDs(t, cfg.outputPath)); want != got {
+		t.Errorf("want %d results got %d", want, got)
+	}
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Values are settings by name, e.g. "auth-user". Lists are comma separated,
+// so list items must not contain commas.
+type Values map[string]string
+
+// Load reads the YAML config file at path.
+func Load(path string) (Values, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return v, nil
+}
+
+// Parse parses a YAML document. Nested keys are joined with a dash, so
+//
+//	auth:
+//	  user: alice
+//
+// is the setting auth-user. Underscores in keys are replaced by dashes and
+// lists are joined with commas. Keys which name the same setting, e.g.
+// auth_user and auth-user, and list items containing commas are reported as
+// errors.
+func Parse(b []byte) (Values, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	v := make(Values)
+	if err := flatten(v, "", doc); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func flatten(v Values, prefix string, doc map[string]interface{}) error {
+	// keys are visited in order, so errors do not depend on map iteration
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := doc[key]
+		name := strings.ReplaceAll(key, "_", "-")
+		if prefix != "" {
+			name = prefix + "-" + name
+		}
+		if _, ok := v[name]; ok {
+			return fmt.Errorf("%s: setting specified more than once", name)
+		}
+		switch val := val.(type) {
+		case map[string]interface{}:
+			if err := flatten(v, name, val); err != nil {
+				return err
+			}
+		case []interface{}:
+			items := make([]string, len(val))
+			for i, item := range val {
+				s, err := scalar(item)
+				if err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
+				if strings.Contains(s, ",") {
+					return fmt.Errorf("%s: list item must not contain a comma: %q", name, s)
+				}
+				items[i] = s
+			}
+			v[name] = strings.Join(items, ",")
+		default:
+			s, err := scalar(val)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			v[name] = s
+		}
+	}
+	return nil
+}
+
+func scalar(val interface{}) (string, error) {
+	switch val.(type) {
+	case map[string]interface{}, []interface{}:
+		return "", errors.New("unexpected nested value")
+	case nil:
+		return "", nil
+	}
+	return fmt.Sprint(val), nil
+}
+
+// Env returns the settings of fs which are set by environment variables. The
+// variable of a setting is its name in upper case with dashes replaced by
+// underscores and the prefix prepended, e.g. NOTIFY_AUTH_USER.
+func Env(fs *flag.FlagSet, aliases map[string]string, prefix string, lookup func(string) (string, bool)) Values {
+	v := make(Values)
+	for _, name := range Names(fs, aliases) {
+		if s, ok := lookup(EnvName(prefix, name)); ok {
+			v[name] = s
+		}
+	}
+	return v
+}
+
+// EnvName returns the environment variable of a setting.
+func EnvName(prefix, name string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Names returns the sorted setting names of the flags of fs. Aliases map
+// setting names to flag names, e.g. "concurrency" to "c".
+func Names(fs *flag.FlagSet, aliases map[string]string) []string {
+	settings := make(map[string]string, len(aliases))
+	for name, flagName := range aliases {
+		settings[flagName] = name
+	}
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		name := f.Name
+		if s, ok := settings[name]; ok {
+			name = s
+		}
+		names = append(names, name)
+	})
+	sort.Strings(names)
+	return names
+}
+
+// Apply sets the flags of fs to the values of the sources. Later sources
+// override earlier ones and flags set on the command line override all
+// sources, so the order of precedence is
+//
+//	command line > sources[n-1] > ... > sources[0] > defaults
+//
+// Settings are named by their flag names or aliases. All unknown settings,
+// invalid values and settings which a source specifies by both their flag
+// name and alias are reported in the returned error.
+func Apply(fs *flag.FlagSet, aliases map[string]string, sources ...Values) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	// values by flag name, the setting names are kept for error messages
+	type value struct{ name, s string }
+	merged := make(map[string]value)
+	var errs []error
+	for _, src := range sources {
+		names := make([]string, 0, len(src))
+		for name := range src {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		byFlag := make(map[string]string, len(src))
+		for _, name := range names {
+			flagName := name
+			if alias, ok := aliases[name]; ok {
+				flagName = alias
+			}
+			if other, ok := byFlag[flagName]; ok {
+				errs = append(errs, fmt.Errorf("conflicting settings: %s and %s", other, name))
+				continue
+			}
+			byFlag[flagName] = name
+			merged[flagName] = value{name: name, s: src[name]}
+		}
+	}
+	flagNames := make([]string, 0, len(merged))
+	for flagName := range merged {
+		flagNames = append(flagNames, flagName)
+	}
+	sort.Strings(flagNames)
+
+	for _, flagName := range flagNames {
+		v := merged[flagName]
+		if fs.Lookup(flagName) == nil {
+			errs = append(errs, fmt.Errorf("unknown setting: %s", v.name))
+			continue
+		}
+		if set[flagName] {
+			continue
+		}
+		if err := fs.Set(flagName, v.s); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for %s: %v", v.s, v.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Snapshot returns the values of all flags of fs by flag name.
+func Snapshot(fs *flag.FlagSet) Values {
+	v := make(Values)
+	fs.VisitAll(func(f *flag.Flag) {
+		v[f.Name] = f.Value.String()
+	})
+	return v
+}
+
+// Changed returns the sorted names of the flags whose values differ between
+// the snapshots a and b.
+func Changed(a, b Values) []string {
+	var names []string
+	for name, s := range a {
+		if t, ok := b[name]; !ok || s != t {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
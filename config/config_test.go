@@ -0,0 +1,192 @@
+package config_test
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/config"
+)
+
+const doc = `
+url: http://localhost:8080
+concurrency: 10
+interval: 50ms
+auth:
+  type: bearer
+  secret_env: TOKEN
+  scopes: [read, write]
+success:
+  status: [200, 202-204]
+`
+
+func TestParse(t *testing.T) {
+	v, err := config.Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := config.Values{
+		"url":             "http://localhost:8080",
+		"concurrency":     "10",
+		"interval":        "50ms",
+		"auth-type":       "bearer",
+		"auth-secret-env": "TOKEN",
+		"auth-scopes":     "read,write",
+		"success-status":  "200,202-204",
+	}
+	if !reflect.DeepEqual(want, v) {
+		t.Errorf("want values\n%v\ngot\n%v", want, v)
+	}
+
+	for _, bad := range []string{
+		"auth: [{type: bearer}]",
+		// lists are comma separated
+		"headers: ['X-Foo: a,b']",
+		// both keys are the setting auth-user
+		"auth_user: alice\nauth:\n  user: bob",
+	} {
+		if _, err := config.Parse([]byte(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+var aliases = map[string]string{"concurrency": "c"}
+
+// flags mimics the flags of a command.
+type flags struct {
+	url         string
+	concurrency int
+	interval    time.Duration
+}
+
+func newFlagSet(f *flags) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&f.url, "url", "", "")
+	fs.IntVar(&f.concurrency, "c", 100, "")
+	fs.DurationVar(&f.interval, "i", 10*time.Millisecond, "")
+	return fs
+}
+
+var applyTests = []struct {
+	d string        // description of test case
+	a []string      // command line arguments
+	f config.Values // config file
+	e config.Values // environment variables
+	w flags         // expected flags, unless an error is expected
+	r []string      // expected parts of the error
+}{
+	{
+		d: "expect defaults",
+		w: flags{concurrency: 100, interval: 10 * time.Millisecond},
+	},
+	{
+		d: "expect config file to override defaults",
+		f: config.Values{"url": "http://file", "concurrency": "5"},
+		w: flags{url: "http://file", concurrency: 5, interval: 10 * time.Millisecond},
+	},
+	{
+		d: "expect environment to override config file",
+		f: config.Values{"url": "http://file", "concurrency": "5"},
+		e: config.Values{"url": "http://env"},
+		w: flags{url: "http://env", concurrency: 5, interval: 10 * time.Millisecond},
+	},
+	{
+		d: "expect command line to override environment",
+		a: []string{"-url", "http://flag", "-c", "1"},
+		f: config.Values{"concurrency": "5"},
+		e: config.Values{"url": "http://env"},
+		w: flags{url: "http://flag", concurrency: 1, interval: 10 * time.Millisecond},
+	},
+	{
+		d: "expect flag names",
+		f: config.Values{"c": "5", "i": "1s"},
+		w: flags{concurrency: 5, interval: time.Second},
+	},
+	{
+		d: "expect all errors",
+		f: config.Values{"foo": "bar", "concurrency": "many", "i": "10"},
+		r: []string{"unknown setting: foo", `invalid value "many" for concurrency`, `invalid value "10" for i`},
+	},
+	{
+		d: "expect error for flag name and alias in one source",
+		f: config.Values{"c": "5", "concurrency": "10"},
+		r: []string{"conflicting settings: c and concurrency"},
+	},
+	{
+		d: "expect flag name to override alias of earlier source",
+		f: config.Values{"concurrency": "10"},
+		e: config.Values{"c": "5"},
+		w: flags{concurrency: 5, interval: 10 * time.Millisecond},
+	},
+	{
+		d: "expect error for unknown setting",
+		f: config.Values{"foo": "bar"},
+		r: []string{"unknown setting: foo"},
+	},
+}
+
+func TestApply(t *testing.T) {
+	for _, tc := range applyTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			var f flags
+			fs := newFlagSet(&f)
+			if err := fs.Parse(tt.a); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err := config.Apply(fs, aliases, tt.f, tt.e)
+			if len(tt.r) == 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tt.r) > 0 && err == nil {
+				t.Fatalf("expected error: %v", tt.r)
+			}
+			for _, r := range tt.r {
+				if !strings.Contains(err.Error(), r) {
+					t.Errorf("want error %q got %v", r, err)
+				}
+			}
+			if len(tt.r) > 0 {
+				return
+			}
+			if want, got := tt.w, f; want != got {
+				t.Errorf("want flags %+v got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestEnv(t *testing.T) {
+	var f flags
+	env := map[string]string{
+		"NOTIFY_URL":         "http://env",
+		"NOTIFY_CONCURRENCY": "5",
+		"NOTIFY_C":           "1", // flags with aliases are set by their alias
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+	v := config.Env(newFlagSet(&f), aliases, "NOTIFY_", lookup)
+	want := config.Values{"url": "http://env", "concurrency": "5"}
+	if !reflect.DeepEqual(want, v) {
+		t.Errorf("want values\n%v\ngot\n%v", want, v)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	var a, b flags
+	fsa, fsb := newFlagSet(&a), newFlagSet(&b)
+	if err := fsa.Parse([]string{"-url", "http://foo", "-c", "5"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := fsb.Parse([]string{"-url", "http://foo", "-c", "10", "-i", "1s"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := []string{"c", "i"}, config.Changed(config.Snapshot(fsa), config.Snapshot(fsb)); !reflect.DeepEqual(want, got) {
+		t.Errorf("want changed %v got %v", want, got)
+	}
+}
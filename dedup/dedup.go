@@ -0,0 +1,248 @@
+package dedup
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+type queue interface {
+	IsExhausted() bool
+	Pop() message.Message
+	Drain() []message.Message
+}
+
+// BodyHash is a KeyFunc which uses the SHA-256 hash of the message body.
+func BodyHash(m message.Message) string {
+	sum := sha256.Sum256([]byte(m.Body))
+	return hex.EncodeToString(sum[:])
+}
+
+// Filter drops messages of a queue whose key was seen within a time window.
+// It is a queue itself, so it is placed between the scanner and the
+// scheduler. Messages without a key are never dropped.
+//
+// A key is seen once a message with the key is delivered. Duplicates which
+// are taken from the queue while the message is in flight are held until it
+// completes. If it is delivered, they are dropped, otherwise the first of them
+// is sent. For this, the Filter must also be written the results of the run.
+type Filter struct {
+	sync.Mutex
+	q           queue
+	key         notify.KeyFunc
+	window      time.Duration
+	seen        *lru
+	log         *Log                         // nil if delivered keys are not persisted
+	inFlight    map[string][]message.Message // held duplicates by key of the messages in flight
+	held        int                          // number of held duplicates
+	ready       []message.Message            // held duplicates whose message completed
+	onDuplicate func(m message.Message)
+	duplicates  int64
+}
+
+// NewFilter returns a Filter which drops duplicates of q. A window of 0 means
+// keys never expire. At most size keys are held in memory, the least recently
+// seen keys are evicted first.
+func NewFilter(q queue, key notify.KeyFunc, window time.Duration, size int) *Filter {
+	return &Filter{
+		q:        q,
+		key:      key,
+		window:   window,
+		seen:     newLRU(size),
+		inFlight: make(map[string][]message.Message),
+	}
+}
+
+// Persist loads the keys of l which are within the window and appends the
+// keys of delivered messages to l, so duplicates are dropped across runs. It
+// must be called before the Filter is used.
+func (f *Filter) Persist(l *Log) {
+	f.Lock()
+	defer f.Unlock()
+	for _, e := range l.Entries() {
+		if !f.expired(e.Time) {
+			f.seen.add(e.Key, e.Time)
+		}
+	}
+	f.log = l
+}
+
+// OnDuplicate sets a function which is called with each dropped message. It
+// must be called before the Filter is used.
+func (f *Filter) OnDuplicate(fn func(m message.Message)) {
+	f.onDuplicate = fn
+}
+
+// IsExhausted determines if all messages of the queue have been consumed and
+// no duplicates are held.
+func (f *Filter) IsExhausted() bool {
+	f.Lock()
+	held := f.held + len(f.ready)
+	f.Unlock()
+	return held == 0 && f.q.IsExhausted()
+}
+
+// Pop removes and returns the first message of the queue which is neither a
+// duplicate nor held. Held duplicates whose message completed are returned
+// first. If the queue is empty, the zero value is returned.
+func (f *Filter) Pop() message.Message {
+	for {
+		msg := f.next()
+		if msg.Body == "" {
+			return msg
+		}
+		switch f.check(msg) {
+		case send:
+			return msg
+		case duplicate:
+			atomic.AddInt64(&f.duplicates, 1)
+			if f.onDuplicate != nil {
+				f.onDuplicate(msg)
+			}
+		}
+	}
+}
+
+// Drain removes and returns the held duplicates and the messages of the
+// queue, e.g. to spool them on shutdown.
+func (f *Filter) Drain() []message.Message {
+	f.Lock()
+	msgs := f.ready
+	for key, held := range f.inFlight {
+		msgs = append(msgs, held...)
+		f.inFlight[key] = nil
+	}
+	f.ready, f.held = nil, 0
+	f.Unlock()
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Pos.Seq < msgs[j].Pos.Seq })
+	return append(msgs, f.q.Drain()...)
+}
+
+// next returns the first held duplicate whose message completed or else the
+// first message of the queue.
+func (f *Filter) next() message.Message {
+	f.Lock()
+	if len(f.ready) > 0 {
+		msg := f.ready[0]
+		f.ready = f.ready[1:]
+		f.Unlock()
+		return msg
+	}
+	f.Unlock()
+	return f.q.Pop()
+}
+
+// verdict of the Filter about a message.
+type verdict int
+
+const (
+	send verdict = iota
+	duplicate
+	hold
+)
+
+// check decides whether msg is sent, dropped or held. A message is held if a
+// message with the same key is in flight, and dropped if the key was seen
+// within the window.
+func (f *Filter) check(msg message.Message) verdict {
+	key := f.key(msg)
+	if key == "" {
+		return send
+	}
+	f.Lock()
+	defer f.Unlock()
+	if held, ok := f.inFlight[key]; ok {
+		f.inFlight[key] = append(held, msg)
+		f.held++
+		return hold
+	}
+	if t, ok := f.seen.get(key); ok && !f.expired(t) {
+		return duplicate
+	}
+	f.inFlight[key] = nil
+	return send
+}
+
+// Write sees and persists the keys of delivered messages. The held duplicates
+// of a completed message are checked again by the next Pop.
+func (f *Filter) Write(res notify.PostResult) error {
+	if res.Duplicate {
+		return nil
+	}
+	key := f.key(message.Message{ID: res.ID, Body: res.Msg, Headers: res.MsgHeaders})
+	if key == "" {
+		return nil
+	}
+	f.Lock()
+	defer f.Unlock()
+	held, ok := f.inFlight[key]
+	if !ok {
+		return nil
+	}
+	delete(f.inFlight, key)
+	f.held -= len(held)
+	f.ready = append(f.ready, held...)
+	if res.Err != nil {
+		return nil
+	}
+	t := time.Now()
+	f.seen.add(key, t)
+	if f.log == nil {
+		return nil
+	}
+	return f.log.Append(Entry{Key: key, Time: t})
+}
+
+// Duplicates returns the number of messages dropped so far.
+func (f *Filter) Duplicates() int {
+	return int(atomic.LoadInt64(&f.duplicates))
+}
+
+func (f *Filter) expired(t time.Time) bool {
+	return f.window > 0 && time.Since(t) > f.window
+}
+
+// lru is a set of keys and the time they were seen, bounded by size. The
+// least recently seen key is evicted first.
+type lru struct {
+	size  int
+	order *list.List // of *Entry, most recently seen first
+	keys  map[string]*list.Element
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		order: list.New(),
+		keys:  make(map[string]*list.Element),
+	}
+}
+
+func (l *lru) get(key string) (time.Time, bool) {
+	e, ok := l.keys[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return e.Value.(*Entry).Time, true
+}
+
+func (l *lru) add(key string, t time.Time) {
+	if e, ok := l.keys[key]; ok {
+		e.Value.(*Entry).Time = t
+		l.order.MoveToFront(e)
+		return
+	}
+	l.keys[key] = l.order.PushFront(&Entry{Key: key, Time: t})
+	if l.size > 0 && l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.keys, oldest.Value.(*Entry).Key)
+	}
+}
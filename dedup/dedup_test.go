@@ -0,0 +1,264 @@
+package dedup_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/dedup"
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+// queue is a mock queue of message bodies.
+type queue []string
+
+func (q *queue) IsExhausted() bool {
+	return len(*q) == 0
+}
+
+func (q *queue) Pop() message.Message {
+	if len(*q) == 0 {
+		return message.Message{}
+	}
+	m := message.Message{Body: (*q)[0]}
+	*q = (*q)[1:]
+	return m
+}
+
+func (q *queue) Drain() []message.Message {
+	var msgs []message.Message
+	for _, body := range *q {
+		msgs = append(msgs, message.Message{Body: body})
+	}
+	*q = nil
+	return msgs
+}
+
+// drain pops all messages of f and returns the bodies of the sent and the
+// dropped messages. Each sent message completes at once, the messages in
+// failed fail.
+func drain(t *testing.T, f *dedup.Filter, failed ...string) ([]string, []string) {
+	var sent, dropped []string
+	f.OnDuplicate(func(m message.Message) {
+		dropped = append(dropped, m.Body)
+	})
+	for !f.IsExhausted() {
+		m := f.Pop()
+		if m.Body == "" {
+			continue
+		}
+		sent = append(sent, m.Body)
+		res := notify.PostResult{Msg: m.Body}
+		for _, body := range failed {
+			if body == m.Body {
+				res.Err = errors.New("failed")
+			}
+		}
+		if err := f.Write(res); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return sent, dropped
+}
+
+var filterTests = []struct {
+	d string        // description of test case
+	b []string      // message bodies
+	k string        // JSONPath of the key, the body hash if empty
+	w time.Duration // window
+	n int           // max number of keys
+	s []string      // expected sent messages
+	r []string      // expected dropped messages
+}{
+	{
+		d: "expect duplicates of the body to be dropped",
+		b: []string{"a", "b", "a", "c", "b"},
+		s: []string{"a", "b", "c"},
+		r: []string{"a", "b"},
+	},
+	{
+		d: "expect duplicates of a field to be dropped",
+		b: []string{`{"id":1,"n":1}`, `{"id":2}`, `{"id":1,"n":2}`},
+		k: "$.id",
+		s: []string{`{"id":1,"n":1}`, `{"id":2}`},
+		r: []string{`{"id":1,"n":2}`},
+	},
+	{
+		d: "expect messages without key to be sent",
+		b: []string{`foo`, `foo`, `{"id":1}`},
+		k: "$.id",
+		s: []string{`foo`, `foo`, `{"id":1}`},
+	},
+	{
+		d: "expect evicted keys to be sent again",
+		b: []string{"a", "b", "c", "a", "c"},
+		n: 2,
+		s: []string{"a", "b", "c", "a"},
+		r: []string{"c"},
+	},
+	{
+		d: "expect expired keys to be sent again",
+		b: []string{"a", "a"},
+		w: time.Nanosecond,
+		s: []string{"a", "a"},
+	},
+}
+
+func TestFilter(t *testing.T) {
+	for _, tc := range filterTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			key := dedup.BodyHash
+			if tt.k != "" {
+				var err error
+				if key, err = notify.JSONKey(tt.k); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			q := queue(tt.b)
+			f := dedup.NewFilter(&q, key, tt.w, tt.n)
+			sent, dropped := drain(t, f)
+			if want, got := tt.s, sent; !reflect.DeepEqual(want, got) {
+				t.Errorf("want sent %v got %v", want, got)
+			}
+			if want, got := tt.r, dropped; !reflect.DeepEqual(want, got) {
+				t.Errorf("want dropped %v got %v", want, got)
+			}
+			if want, got := len(tt.r), f.Duplicates(); want != got {
+				t.Errorf("want %d duplicates got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestFilterFailure(t *testing.T) {
+	q := queue{"a"}
+	f := dedup.NewFilter(&q, dedup.BodyHash, 0, 0)
+	drain(t, f, "a")
+	// the key of the failed message is not seen
+	q = queue{"a", "a"}
+	sent, dropped := drain(t, f)
+	if want, got := []string{"a"}, sent; !reflect.DeepEqual(want, got) {
+		t.Errorf("want sent %v got %v", want, got)
+	}
+	if want, got := []string{"a"}, dropped; !reflect.DeepEqual(want, got) {
+		t.Errorf("want dropped %v got %v", want, got)
+	}
+}
+
+func TestFilterInFlight(t *testing.T) {
+	q := queue{"a", "a", "a", "b"}
+	f := dedup.NewFilter(&q, dedup.BodyHash, 0, 0)
+	var dropped []string
+	f.OnDuplicate(func(m message.Message) {
+		dropped = append(dropped, m.Body)
+	})
+	pop := func(want string) {
+		t.Helper()
+		if got := f.Pop().Body; want != got {
+			t.Errorf("want message %q got %q", want, got)
+		}
+	}
+	write := func(body string, err error) {
+		t.Helper()
+		if err := f.Write(notify.PostResult{Msg: body, Err: err}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// duplicates of a are held while it is in flight
+	pop("a")
+	pop("b")
+	pop("")
+	if f.IsExhausted() {
+		t.Error("expect filter with held duplicates not to be exhausted")
+	}
+	// a failed, so the first duplicate is sent
+	write("a", errors.New("failed"))
+	pop("a")
+	pop("")
+	// a is delivered, so the second duplicate is dropped
+	write("a", nil)
+	pop("")
+	if want, got := []string{"a"}, dropped; !reflect.DeepEqual(want, got) {
+		t.Errorf("want dropped %v got %v", want, got)
+	}
+	if !f.IsExhausted() {
+		t.Error("expect filter to be exhausted")
+	}
+}
+
+func TestFilterDrain(t *testing.T) {
+	q := queue{"a", "a", "b", "c"}
+	f := dedup.NewFilter(&q, dedup.BodyHash, 0, 0)
+	for _, want := range []string{"a", "b"} {
+		if got := f.Pop().Body; want != got {
+			t.Fatalf("want message %q got %q", want, got)
+		}
+	}
+	// the held duplicate is drained with the queue
+	var got []string
+	for _, m := range f.Drain() {
+		got = append(got, m.Body)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(want, got) {
+		t.Errorf("want drained %v got %v", want, got)
+	}
+	if !f.IsExhausted() {
+		t.Error("expect filter to be exhausted")
+	}
+}
+
+func TestPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys.jsonl")
+
+	// run sends a, b and c, only a and c are delivered
+	run := func() ([]string, []string) {
+		l, err := dedup.OpenLog(path, time.Hour)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer l.Close()
+		q := queue{"a", "b", "c"}
+		f := dedup.NewFilter(&q, dedup.BodyHash, time.Hour, 0)
+		f.Persist(l)
+		return drain(t, f, "b")
+	}
+
+	sent, _ := run()
+	if want, got := []string{"a", "b", "c"}, sent; !reflect.DeepEqual(want, got) {
+		t.Errorf("want sent %v got %v", want, got)
+	}
+	sent, dropped := run()
+	if want, got := []string{"b"}, sent; !reflect.DeepEqual(want, got) {
+		t.Errorf("want sent %v got %v", want, got)
+	}
+	if want, got := []string{"a", "c"}, dropped; !reflect.DeepEqual(want, got) {
+		t.Errorf("want dropped %v got %v", want, got)
+	}
+
+	// expired entries are removed when the log is opened
+	l, err := dedup.OpenLog(path, time.Nanosecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l.Close()
+	l, err = dedup.OpenLog(path, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer l.Close()
+	if want, got := 0, len(l.Entries()); want != got {
+		t.Errorf("want %d entries got %d", want, got)
+	}
+}
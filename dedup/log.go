@@ -0,0 +1,184 @@
+package dedup
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is a key and the time it was seen.
+type Entry struct {
+	Key  string    `json:"key"`
+	Time time.Time `json:"time"`
+}
+
+// minCompactSize is the min size of a log in bytes before it is compacted.
+const minCompactSize = 1 << 20
+
+// Log is a file of seen keys, one JSON encoded Entry per line. It is safe for
+// concurrent use.
+//
+// The log is compacted when it is opened and whenever it has grown to twice
+// its size after the last compaction: expired entries are removed and only
+// the latest entry of each key is kept.
+type Log struct {
+	sync.Mutex
+	path      string
+	window    time.Duration
+	f         *os.File
+	size      int64 // of the file in bytes
+	compactAt int64 // size of the file which triggers the next compaction
+	entries   []Entry
+}
+
+// OpenLog opens the log at path, creating it if it does not exist. Entries
+// older than window are removed from the file, a window of 0 keeps all
+// entries.
+func OpenLog(path string, window time.Duration) (*Log, error) {
+	l := &Log{path: path, window: window}
+	entries, err := l.compact()
+	if err != nil {
+		return nil, err
+	}
+	l.entries = entries
+	return l, nil
+}
+
+// Entries returns the entries of the log when it was opened. The entries are
+// released by the log, so a second call returns none.
+func (l *Log) Entries() []Entry {
+	l.Lock()
+	defer l.Unlock()
+	entries := l.entries
+	l.entries = nil
+	return entries
+}
+
+// Append adds an entry to the log.
+func (l *Log) Append(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.Lock()
+	defer l.Unlock()
+	n, err := l.f.Write(append(b, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if l.size < l.compactAt {
+		return nil
+	}
+	_, err = l.compact()
+	return err
+}
+
+// Close closes the file of the log.
+func (l *Log) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	return l.f.Close()
+}
+
+// compact replaces the file of the log by its live entries and reopens it.
+// It returns the live entries.
+func (l *Log) compact() ([]Entry, error) {
+	entries, err := readLog(l.path)
+	if err != nil {
+		return nil, err
+	}
+	// only the latest entry of a key is kept
+	latest := make(map[string]int, len(entries))
+	live := entries[:0]
+	for _, e := range entries {
+		if l.window > 0 && time.Since(e.Time) > l.window {
+			continue
+		}
+		if i, ok := latest[e.Key]; ok {
+			if e.Time.After(live[i].Time) {
+				live[i] = e
+			}
+			continue
+		}
+		latest[e.Key] = len(live)
+		live = append(live, e)
+	}
+	if err := writeLog(l.path, live); err != nil {
+		return nil, err
+	}
+	if l.f != nil {
+		l.f.Close()
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	l.f, l.size = f, fi.Size()
+	l.compactAt = 2 * l.size
+	if l.compactAt < minCompactSize {
+		l.compactAt = minCompactSize
+	}
+	return live, nil
+}
+
+// readLog reads the entries of the log at path. Lines which cannot be decoded,
+// e.g. the last line after a crash, are skipped.
+func readLog(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Key == "" {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// writeLog replaces the log at path with the entries. The file is replaced
+// atomically, so a crash never loses the entries of the log.
+func writeLog(path string, entries []Entry) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,66 @@
+package dedup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys.jsonl")
+
+	l, err := OpenLog(path, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer l.Close()
+	// compact after a few entries instead of a megabyte
+	l.compactAt = 200
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		// a key seen again and an expired key are compacted away
+		for _, e := range []Entry{{Key: "a", Time: now.Add(time.Duration(i))}, {Key: "b", Time: now.Add(-2 * time.Hour)}} {
+			if err := l.Append(e); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+	entries, err := readLog(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) >= 20 {
+		t.Fatalf("want log to be compacted got %d entries", len(entries))
+	}
+	if l.compactAt < minCompactSize {
+		t.Errorf("want next compaction at %d bytes or more got %d", minCompactSize, l.compactAt)
+	}
+
+	// appends continue after the compaction
+	if err := l.Append(Entry{Key: "c", Time: now}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entries, err = readLog(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := "c", entries[len(entries)-1].Key; want != got {
+		t.Errorf("want last key %s got %s", want, got)
+	}
+
+	// entries are released once they were read
+	l.entries = []Entry{{Key: "a"}}
+	if want, got := 1, len(l.Entries()); want != got {
+		t.Errorf("want %d entries got %d", want, got)
+	}
+	if want, got := 0, len(l.Entries()); want != got {
+		t.Errorf("want %d entries got %d", want, got)
+	}
+}
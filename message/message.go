@@ -0,0 +1,24 @@
+package message
+
+// Message is a notification passed through the stages of the pipeline.
+// With JSON Lines input, each line holds a JSON encoded Message.
+type Message struct {
+	ID      string            `json:"id"`                // identifies the message, e.g. by its line number in the input
+	Body    string            `json:"body"`              // payload sent to the target URL
+	Headers map[string]string `json:"headers,omitempty"` // request headers sent with the message
+
+	// Pos is the position of the message in the input.
+	Pos Position `json:"-"`
+
+	// Trace identifies the trace of the message in package tracing. It is 0
+	// if the message is not traced.
+	Trace uint64 `json:"-"`
+}
+
+// Position is the position of a message in the input. The zero value means
+// the position is unknown.
+type Position struct {
+	Seq    int64 // number of the message in the input, starting at 1
+	Line   int   // line number, starting at 1
+	Offset int64 // byte offset of the end of the line
+}
@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "notify"
+
+// Sources provide the state of the stages of the pipeline. Nil functions are
+// not exported.
+type Sources struct {
+	QueueDepth  func() int // messages waiting to be scheduled
+	Emitted     func() int // messages sent by the scheduler so far
+	InFlight    func() int // requests which have not returned yet
+	Concurrency func() int // max number of concurrent requests
+}
+
+// Metrics exposes the state of the pipeline and the results of requests in
+// the Prometheus format. It is a result Writer and provides a Middleware to
+// observe requests on the wire.
+type Metrics struct {
+	registry  *prometheus.Registry
+	latency   *prometheus.HistogramVec
+	errors    *prometheus.CounterVec
+	retries   prometheus.Counter
+	sentBytes prometheus.Counter
+}
+
+// New returns Metrics. The state of the pipeline is exported once its Sources
+// are provided with Observe.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of messages including all attempts, by status class of the last response.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+		}, []string{"status_class"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Messages which could not be delivered, by error class.",
+		}, []string{"class"}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retries_total",
+			Help:      "Attempts after the first one.",
+		}),
+		sentBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sent_bytes_total",
+			Help:      "Request body bytes sent, including retries.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.latency, m.errors, m.retries, m.sentBytes,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Observe exports the state of the pipeline provided by src. It must be
+// called once at most.
+func (m *Metrics) Observe(src Sources) {
+	gauges := []struct {
+		name, help string
+		f          func() int
+	}{
+		{"queue_depth", "Messages waiting to be scheduled.", src.QueueDepth},
+		{"requests_in_flight", "Requests which have not returned yet.", src.InFlight},
+		{"concurrency_limit", "Max number of concurrent requests.", src.Concurrency},
+	}
+	for _, g := range gauges {
+		if g.f == nil {
+			continue
+		}
+		f := g.f
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      g.name,
+			Help:      g.help,
+		}, func() float64 { return float64(f()) }))
+	}
+	if src.Emitted != nil {
+		m.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scheduler_emitted_total",
+			Help:      "Messages sent by the scheduler.",
+		}, func() float64 { return float64(src.Emitted()) }))
+	}
+}
+
+// Write records a result.
+func (m *Metrics) Write(res notify.PostResult) error {
+	if res.Attempts > 1 {
+		m.retries.Add(float64(res.Attempts - 1))
+	}
+	if res.Attempts > 0 {
+		m.latency.WithLabelValues(statusClass(res.StatusCode)).Observe(res.Timing.Total / 1000)
+	}
+	if res.Err != nil {
+		m.errors.WithLabelValues(notify.Classify(res.Err).Class).Inc()
+	}
+	return nil
+}
+
+// Middleware counts the bytes of request bodies as they are sent.
+func (m *Metrics) Middleware(next http.RoundTripper) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.ContentLength > 0 {
+			m.sentBytes.Add(float64(req.ContentLength))
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+// Handler returns a Handler which serves the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// statusClass returns the class of a status code, e.g. 2xx, or none if no
+// response was received.
+func statusClass(code int) string {
+	if code < 100 {
+		return "none"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
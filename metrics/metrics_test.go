@@ -0,0 +1,61 @@
+package metrics_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/metrics"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New()
+	m.Observe(metrics.Sources{
+		QueueDepth:  func() int { return 3 },
+		Emitted:     func() int { return 7 },
+		InFlight:    func() int { return 2 },
+		Concurrency: func() int { return 10 },
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	c := notify.NewHttpClient(srv.URL, notify.WithMiddleware(m.Middleware))
+	res := c.Post(context.Background(), message.Message{Body: "foo"})
+	res.Attempts = 3
+	if err := m.Write(res); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	b, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metricsTests = []string{
+		"notify_queue_depth 3",
+		"notify_scheduler_emitted_total 7",
+		"notify_requests_in_flight 2",
+		"notify_concurrency_limit 10",
+		`notify_request_duration_seconds_count{status_class="5xx"} 1`,
+		`notify_errors_total{class="http_status"} 1`,
+		"notify_retries_total 2",
+		"notify_sent_bytes_total 3",
+	}
+	for _, tc := range metricsTests {
+		tt := tc
+		t.Run(tt, func(t *testing.T) {
+			if !strings.Contains(string(b), tt+"\n") {
+				t.Errorf("want metric %q", tt)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator sets credentials on outgoing requests.
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *http.Request) error
+}
+
+// refresher is implemented by Authenticators that can discard cached
+// credentials, e.g. when a receiver rejects them with 401 Unauthorized.
+// Credentials are only discarded if they are the ones the rejected request
+// was authenticated with, so a fresh token obtained by a concurrent request
+// is kept.
+type refresher interface {
+	Invalidate(rejected *http.Request)
+}
+
+// WithAuth authenticates each request with the provided Authenticator.
+func WithAuth(a Authenticator) ClientOption {
+	return func(c *HttpClient) {
+		c.auth = a
+	}
+}
+
+// SetAuth replaces the Authenticator of the HttpClient, nil disables
+// authentication. New requests use the new Authenticator, in-flight requests
+// are not affected.
+func (c *HttpClient) SetAuth(a Authenticator) {
+	c.mu.Lock()
+	c.auth = a
+	c.mu.Unlock()
+}
+
+// Auth returns the Authenticator of the HttpClient, nil if there is none.
+func (c *HttpClient) Auth() Authenticator {
+	return c.settings().auth
+}
+
+// BearerToken authenticates requests with a static bearer token.
+type BearerToken string
+
+func (t BearerToken) Authenticate(_ context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// BasicAuth authenticates requests with HTTP basic authentication.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (b BasicAuth) Authenticate(_ context.Context, req *http.Request) error {
+	req.SetBasicAuth(b.Username, b.Password)
+	return nil
+}
+
+// ClientCredentials authenticates requests with an access token obtained by
+// the OAuth2 client credentials grant. Tokens are cached and refreshed before
+// they expire.
+type ClientCredentials struct {
+	client       *http.Client
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	refreshAhead time.Duration // refresh tokens this long before they expire
+	fetchTimeout time.Duration // of a token request
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	pending *tokenCall // token request in flight, nil if there is none
+}
+
+// tokenCall is a token request shared by concurrent callers of Token.
+type tokenCall struct {
+	done  chan struct{} // closed once token and err are set
+	token string
+	err   error
+}
+
+// NewClientCredentials returns a reference to a ClientCredentials
+// Authenticator. If client is nil, http.DefaultClient is used to request
+// tokens, see NewTokenClient.
+func NewClientCredentials(client *http.Client, tokenURL, clientID, clientSecret string, scopes []string) *ClientCredentials {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &ClientCredentials{
+		client:       client,
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		refreshAhead: 30 * time.Second,
+		fetchTimeout: 30 * time.Second,
+	}
+}
+
+// NewTokenClient returns a client for token requests which uses the TLS
+// configuration, e.g. to present a client certificate, and gives up after
+// timeout.
+func NewTokenClient(tlsConfig *tls.Config, timeout time.Duration) *http.Client {
+	return &http.Client{Transport: newTransport(tlsConfig), Timeout: timeout}
+}
+
+// SetClient replaces the client of token requests, e.g. to pick up a
+// reloaded TLS configuration. The cached token is kept, a token request in
+// flight is not affected.
+func (cc *ClientCredentials) SetClient(client *http.Client) {
+	cc.mu.Lock()
+	old := cc.client
+	cc.client = client
+	cc.mu.Unlock()
+	old.CloseIdleConnections()
+}
+
+func (cc *ClientCredentials) Authenticate(ctx context.Context, req *http.Request) error {
+	token, err := cc.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Token returns a cached access token or requests a new one if there is no
+// token or the cached one is about to expire. Concurrent callers wait for a
+// single token request. The request is not bound to ctx, so a caller which
+// gives up waiting does not fail the request for the others.
+func (cc *ClientCredentials) Token(ctx context.Context) (string, error) {
+	cc.mu.Lock()
+	if cc.token != "" && time.Now().Add(cc.refreshAhead).Before(cc.expires) {
+		token := cc.token
+		cc.mu.Unlock()
+		return token, nil
+	}
+	call := cc.pending
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		cc.pending = call
+		go cc.refresh(cc.client, call)
+	}
+	cc.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-call.done:
+		return call.token, call.err
+	}
+}
+
+// refresh requests a new token with client, caches it and passes it to the
+// callers waiting for call.
+func (cc *ClientCredentials) refresh(client *http.Client, call *tokenCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), cc.fetchTimeout)
+	defer cancel()
+	token, expiresIn, err := cc.fetch(ctx, client)
+
+	cc.mu.Lock()
+	if err == nil {
+		cc.token = token
+		cc.expires = time.Now().Add(expiresIn)
+	}
+	cc.pending = nil
+	cc.mu.Unlock()
+
+	call.token, call.err = token, err
+	close(call.done)
+}
+
+// Invalidate discards the cached token if rejected was authenticated with it.
+func (cc *ClientCredentials) Invalidate(rejected *http.Request) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.token != "" && rejected.Header.Get("Authorization") == "Bearer "+cc.token {
+		cc.token = ""
+	}
+}
+
+func (cc *ClientCredentials) fetch(ctx context.Context, client *http.Client) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(cc.scopes) > 0 {
+		form.Set("scope", strings.Join(cc.scopes, " "))
+	}
+	req, err := http.NewRequest(http.MethodPost, cc.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(cc.clientID), url.QueryEscape(cc.clientSecret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", 0, fmt.Errorf("token request failed: %d: %s", resp.StatusCode, body)
+	}
+
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return "", 0, fmt.Errorf("decode token response: %v", err)
+	}
+	if tr.AccessToken == "" {
+		return "", 0, errors.New("token response contains no access token")
+	}
+	if tr.TokenType != "" && !strings.EqualFold(tr.TokenType, "bearer") {
+		return "", 0, fmt.Errorf("unsupported token type: %s", tr.TokenType)
+	}
+	// tokens without expiry are kept for an hour
+	expiresIn := time.Hour
+	if tr.ExpiresIn > 0 {
+		expiresIn = time.Duration(tr.ExpiresIn) * time.Second
+	}
+	return tr.AccessToken, expiresIn, nil
+}
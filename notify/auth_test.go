@@ -0,0 +1,218 @@
+package notify_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+var authTests = []struct {
+	d string               // description of test case
+	a notify.Authenticator // authenticator used by the client
+	h string               // expected authorization header
+}{
+	{
+		d: "expect bearer token to be sent",
+		a: notify.BearerToken("foo"),
+		h: "Bearer foo",
+	},
+	{
+		d: "expect basic auth credentials to be sent",
+		a: notify.BasicAuth{Username: "foo", Password: "bar"},
+		h: "Basic Zm9vOmJhcg==",
+	},
+}
+
+func TestAuth(t *testing.T) {
+	for _, tc := range authTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if want, got := tt.h, r.Header.Get("Authorization"); want != got {
+					t.Errorf("want authorization header %q got %q", want, got)
+				}
+			}))
+			defer srv.Close()
+
+			c := notify.NewHttpClient(srv.URL, notify.WithAuth(tt.a))
+			if res := c.Post(context.Background(), message.Message{Body: "foo"}); res.Err != nil {
+				t.Errorf("unexpected err: %v", res.Err)
+			}
+		})
+	}
+}
+
+// tokenServer issues numbered tokens via the client credentials grant.
+type tokenServer struct {
+	sync.Mutex
+	issued    int
+	expiresIn int // token lifetime in seconds
+}
+
+func (ts *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != "client" || secret != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ts.Lock()
+	ts.issued++
+	n := ts.issued
+	ts.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"access_token":"token%d","token_type":"bearer","expires_in":%d}`, n, ts.expiresIn)
+}
+
+func TestClientCredentials(t *testing.T) {
+	tokens := &tokenServer{expiresIn: 3600}
+	tokenSrv := httptest.NewServer(tokens)
+	defer tokenSrv.Close()
+
+	// the receiver only accepts the second token issued, which forces the
+	// client to retry with a fresh token after the first request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}))
+	defer srv.Close()
+
+	cc := notify.NewClientCredentials(tokenSrv.Client(), tokenSrv.URL, "client", "secret", []string{"notify"})
+	c := notify.NewHttpClient(srv.URL, notify.WithAuth(cc))
+	for i := 0; i < 3; i++ {
+		if res := c.Post(context.Background(), message.Message{Body: "foo"}); res.Err != nil {
+			t.Fatalf("unexpected err: %v", res.Err)
+		}
+	}
+	// one token for the first attempt, one for the retry, then cached
+	if want, got := 2, tokens.issued; want != got {
+		t.Errorf("want %d tokens issued got %d", want, got)
+	}
+
+	// invalid client credentials
+	cc = notify.NewClientCredentials(tokenSrv.Client(), tokenSrv.URL, "client", "wrong", nil)
+	c = notify.NewHttpClient(srv.URL, notify.WithAuth(cc))
+	if res := c.Post(context.Background(), message.Message{Body: "foo"}); res.Err == nil {
+		t.Error("expect error for invalid client credentials")
+	}
+}
+
+func TestClientCredentialsRefresh(t *testing.T) {
+	// tokens which expire within the refresh window are renewed before use
+	tokens := &tokenServer{expiresIn: 10}
+	tokenSrv := httptest.NewServer(tokens)
+	defer tokenSrv.Close()
+
+	cc := notify.NewClientCredentials(tokenSrv.Client(), tokenSrv.URL, "client", "secret", nil)
+	for i := 1; i <= 2; i++ {
+		token, err := cc.Token(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if want, got := fmt.Sprintf("token%d", i), token; want != got {
+			t.Errorf("want token %s got %s", want, got)
+		}
+	}
+}
+
+func TestClientCredentialsInvalidate(t *testing.T) {
+	tokens := &tokenServer{expiresIn: 3600}
+	tokenSrv := httptest.NewServer(tokens)
+	defer tokenSrv.Close()
+
+	cc := notify.NewClientCredentials(tokenSrv.Client(), tokenSrv.URL, "client", "secret", nil)
+	rejected := func(token string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+	var invalidateTests = []struct {
+		d string // description of test case
+		r string // token of the rejected request
+		t string // expected token after invalidation
+	}{
+		{
+			d: "expect token to be kept if another token was rejected",
+			r: "stale",
+			t: "token1",
+		},
+		{
+			d: "expect new token if the cached token was rejected",
+			r: "token1",
+			t: "token2",
+		},
+	}
+	if _, err := cc.Token(context.Background()); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	for _, tt := range invalidateTests {
+		cc.Invalidate(rejected(tt.r))
+		token, err := cc.Token(context.Background())
+		if err != nil {
+			t.Fatalf("%s: unexpected err: %v", tt.d, err)
+		}
+		if want, got := tt.t, token; want != got {
+			t.Errorf("%s: want token %s got %s", tt.d, want, got)
+		}
+	}
+}
+
+func TestClientCredentialsConcurrent(t *testing.T) {
+	tokens := &tokenServer{expiresIn: 3600}
+	release := make(chan struct{})
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		tokens.ServeHTTP(w, r)
+	}))
+	defer tokenSrv.Close()
+
+	cc := notify.NewClientCredentials(tokenSrv.Client(), tokenSrv.URL, "client", "secret", nil)
+
+	// a caller which gives up waiting does not cancel the token request
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, err := cc.Token(ctx)
+		canceled <- err
+	}()
+	cancel()
+	if want, got := context.Canceled, <-canceled; want != got {
+		t.Errorf("want err %v got %v", want, got)
+	}
+
+	// concurrent callers share a single token request
+	var wg sync.WaitGroup
+	issued := make([]string, 5)
+	for i := range issued {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, err := cc.Token(context.Background())
+			if err != nil {
+				t.Errorf("unexpected err: %v", err)
+			}
+			issued[i] = token
+		}(i)
+	}
+	close(release)
+	wg.Wait()
+	for _, token := range issued {
+		if want, got := "token1", token; want != got {
+			t.Errorf("want token %s got %s", want, got)
+		}
+	}
+	if want, got := 1, tokens.issued; want != got {
+		t.Errorf("want %d tokens issued got %d", want, got)
+	}
+}
@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/fgrimme/refurbed/message"
+)
+
+// request body formats of batches.
+const (
+	BatchJSON   = "json"   // JSON array, messages which are valid JSON are embedded as is
+	BatchNDJSON = "ndjson" // newline delimited JSON, one message per line
+	BatchText   = "text"   // newline joined plain text
+)
+
+// mappings of a batch response to the results of its messages.
+const (
+	// BatchResultsAll applies the response to all messages of the batch.
+	BatchResultsAll = "all"
+	// BatchResultsItems expects a JSON array in the response body holding one
+	// status per message, in the order of the batch. Items are either a status
+	// code or an object like {"status": 500, "error": "reason"}.
+	BatchResultsItems = "items"
+)
+
+// BatchClient posts multiple messages with a single request.
+type BatchClient interface {
+	PostBatch(ctx context.Context, msgs []message.Message) []PostResult
+}
+
+// BatchEncoder encodes batches into request bodies and maps responses back to
+// the results of the messages.
+type BatchEncoder struct {
+	format  string
+	results string
+}
+
+// NewBatchEncoder returns a reference to a BatchEncoder.
+func NewBatchEncoder(format, results string) (*BatchEncoder, error) {
+	switch format {
+	case BatchJSON, BatchNDJSON, BatchText:
+	default:
+		return nil, fmt.Errorf("unsupported batch format: %s", format)
+	}
+	switch results {
+	case BatchResultsAll, BatchResultsItems:
+	default:
+		return nil, fmt.Errorf("unsupported batch results: %s", results)
+	}
+	return &BatchEncoder{
+		format:  format,
+		results: results,
+	}, nil
+}
+
+// WithBatchEncoder uses the provided BatchEncoder for batch requests.
+// Without it, batches are sent as JSON arrays and the response applies to all
+// messages.
+func WithBatchEncoder(e *BatchEncoder) ClientOption {
+	return func(c *HttpClient) {
+		c.batchEncoder = e
+	}
+}
+
+var defaultBatchEncoder = &BatchEncoder{
+	format:  BatchJSON,
+	results: BatchResultsAll,
+}
+
+// PostBatch sends the messages with a single POST request to the clients
+// target URL and returns one PostResult per message, in the order of msgs.
+func (c *HttpClient) PostBatch(ctx context.Context, msgs []message.Message) []PostResult {
+	e := c.batchEncoder
+	if e == nil {
+		e = defaultBatchEncoder
+	}
+	body, contentType, err := e.encode(msgs)
+	if err != nil {
+		return batchResults(msgs, response{}, newPostErr(err, nil))
+	}
+	var headers map[string]string
+	if c.idempotency != nil {
+		headers = c.idempotency.headers(nil, c.idempotency.batchKey(msgs))
+	}
+	resp, err := c.post(ctx, body, contentType, headers, e.results == BatchResultsItems)
+	if err != nil || e.results == BatchResultsAll {
+		return batchResults(msgs, resp, err)
+	}
+	return e.decode(msgs, resp)
+}
+
+func (e *BatchEncoder) encode(msgs []message.Message) ([]byte, string, error) {
+	lines := make([]string, len(msgs))
+	for i, m := range msgs {
+		lines[i] = m.Body
+	}
+	switch e.format {
+	case BatchNDJSON:
+		return []byte(strings.Join(lines, "\n") + "\n"), "application/x-ndjson", nil
+	case BatchText:
+		return []byte(strings.Join(lines, "\n")), "text/plain", nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		item, err := jsonItem(line)
+		if err != nil {
+			return nil, "", err
+		}
+		buf.Write(item)
+	}
+	buf.WriteString("]\n")
+	return buf.Bytes(), "application/json", nil
+}
+
+// jsonItem returns the encoding of a message in a JSON array. Messages which
+// are valid JSON are embedded as is, others are encoded as strings.
+func jsonItem(line string) ([]byte, error) {
+	if json.Valid([]byte(line)) {
+		return json.Marshal(json.RawMessage(line))
+	}
+	return json.Marshal(line)
+}
+
+// Size returns the number of bytes m adds to the request body of a batch,
+// including its separator.
+func (e *BatchEncoder) Size(m message.Message) int {
+	if e.format != BatchJSON {
+		return len(m.Body) + 1
+	}
+	item, err := jsonItem(m.Body)
+	if err != nil {
+		return len(m.Body) + 1
+	}
+	return len(item) + 1
+}
+
+// Overhead returns the number of bytes of the request body of a batch in
+// addition to the sizes of its messages: the brackets and the trailing
+// newline of a JSON array, minus the separator of the last message.
+func (e *BatchEncoder) Overhead() int {
+	switch e.format {
+	case BatchJSON:
+		return 2
+	case BatchText:
+		return -1
+	}
+	return 0
+}
+
+// decode maps a per-item status array to the results of the messages.
+func (e *BatchEncoder) decode(msgs []message.Message, resp response) []PostResult {
+	var items []json.RawMessage
+	if err := json.Unmarshal(resp.raw, &items); err != nil {
+		return batchResults(msgs, resp, newPostErr(validationError{fmt.Sprintf("decode batch response: %v", err)}, nil))
+	}
+	if len(items) != len(msgs) {
+		return batchResults(msgs, resp, newPostErr(validationError{
+			fmt.Sprintf("batch response holds %d items for %d messages", len(items), len(msgs)),
+		}, nil))
+	}
+	res := make([]PostResult, len(msgs))
+	for i, item := range items {
+		res[i] = resp.result(msgs[i], nil)
+		res[i].Body = string(item)
+		var status struct {
+			Status int    `json:"status"`
+			Error  string `json:"error"`
+		}
+		if err := json.Unmarshal(item, &status.Status); err != nil {
+			if err := json.Unmarshal(item, &status); err != nil {
+				res[i].Err = newPostErr(validationError{fmt.Sprintf("decode batch item: %v", err)}, nil)
+				continue
+			}
+		}
+		if status.Status < 200 || status.Status > 299 {
+			if status.Error == "" {
+				status.Error = fmt.Sprintf("item status %d", status.Status)
+			}
+			res[i].Err = newPostErr(statusError{code: status.Status, body: []byte(status.Error)}, nil)
+		}
+	}
+	return res
+}
+
+// batchResults returns the same result for all messages.
+func batchResults(msgs []message.Message, resp response, err error) []PostResult {
+	res := make([]PostResult, len(msgs))
+	for i, msg := range msgs {
+		res[i] = resp.result(msg, err)
+	}
+	return res
+}
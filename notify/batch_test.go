@@ -0,0 +1,146 @@
+package notify_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/rs/zerolog"
+)
+
+var batchTests = []struct {
+	d    string   // description of test case
+	f    string   // batch format
+	r    string   // batch results
+	resp string   // response body of the receiver
+	body string   // expected request body
+	errs []bool   // expected errors per message
+	msgs []string // messages of the batch
+}{
+	{
+		d:    "expect JSON array with embedded JSON messages",
+		f:    notify.BatchJSON,
+		r:    notify.BatchResultsAll,
+		body: `[{"id":1},"foo"]` + "\n",
+		msgs: []string{`{"id":1}`, "foo"},
+		errs: []bool{false, false},
+	},
+	{
+		d:    "expect JSON messages to be compacted and strings to be escaped",
+		f:    notify.BatchJSON,
+		r:    notify.BatchResultsAll,
+		body: `[{"a":"\u003cb\u003e"},"say \"hi\""]` + "\n",
+		msgs: []string{`{ "a": "<b>" }`, `say "hi"`},
+		errs: []bool{false, false},
+	},
+	{
+		d:    "expect newline delimited JSON",
+		f:    notify.BatchNDJSON,
+		r:    notify.BatchResultsAll,
+		body: "{\"id\":1}\n{\"id\":2}\n",
+		msgs: []string{`{"id":1}`, `{"id":2}`},
+		errs: []bool{false, false},
+	},
+	{
+		d:    "expect per item status to be mapped to results",
+		f:    notify.BatchText,
+		r:    notify.BatchResultsItems,
+		resp: `[200, {"status": 500, "error": "failed"}, {"status": 202}]`,
+		body: "foo\nbar\nbaz",
+		msgs: []string{"foo", "bar", "baz"},
+		errs: []bool{false, true, false},
+	},
+	{
+		d:    "expect all messages to fail on item count mismatch",
+		f:    notify.BatchText,
+		r:    notify.BatchResultsItems,
+		resp: `[200]`,
+		body: "foo\nbar",
+		msgs: []string{"foo", "bar"},
+		errs: []bool{true, true},
+	},
+}
+
+func TestPostBatch(t *testing.T) {
+	for _, tc := range batchTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want, got := tt.body, string(b); want != got {
+					t.Errorf("want request body %q got %q", want, got)
+				}
+				_, _ = w.Write([]byte(tt.resp))
+			}))
+			defer srv.Close()
+
+			e, err := notify.NewBatchEncoder(tt.f, tt.r)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			c := notify.NewHttpClient(srv.URL, notify.WithBatchEncoder(e))
+			msgs := make([]message.Message, len(tt.msgs))
+			size := e.Overhead()
+			for i, m := range tt.msgs {
+				msgs[i] = message.Message{ID: strconv.Itoa(i), Body: m}
+				size += e.Size(msgs[i])
+			}
+			if want, got := len(tt.body), size; want != got {
+				t.Errorf("want batch size %d got %d", want, got)
+			}
+			res := c.PostBatch(context.Background(), msgs)
+			if want, got := len(tt.msgs), len(res); want != got {
+				t.Fatalf("want %d results got %d", want, got)
+			}
+			for i, r := range res {
+				if want, got := tt.msgs[i], r.Msg; want != got {
+					t.Errorf("want message %q got %q", want, got)
+				}
+				if want, got := strconv.Itoa(i), r.ID; want != got {
+					t.Errorf("want id %q got %q", want, got)
+				}
+				if want, got := tt.errs[i], r.Err != nil; want != got {
+					t.Errorf("message %q: want err %v got %v", r.Msg, want, r.Err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunBatches(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	c := notify.NewHttpClient(srv.URL)
+	s, err := notify.NewBatchService(c, timeout, 2, zerolog.New(ioutil.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	batches := make(chan []message.Message, 3)
+	batches <- []message.Message{{Body: "foo 1"}, {Body: "foo 2"}}
+	batches <- []message.Message{}
+	batches <- []message.Message{{Body: "bar 1"}}
+	close(batches)
+
+	var got []string
+	for res := range s.RunBatches(context.Background(), batches) {
+		if res.Err != nil {
+			t.Errorf("unexpected err: %v", res.Err)
+		}
+		got = append(got, res.Msg)
+	}
+	sort.Strings(got)
+	if want := []string{"bar 1", "foo 1", "foo 2"}; !reflect.DeepEqual(want, got) {
+		t.Errorf("want results for %v got %v", want, got)
+	}
+}
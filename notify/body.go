@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// capture modes of response bodies.
+const (
+	// BodyKeep keeps response bodies in the results.
+	BodyKeep = "keep"
+	// BodyDiscardSuccess drops bodies of successful responses from the results.
+	BodyDiscardSuccess = "discard-success"
+	// BodyFile saves full response bodies to one file per request.
+	BodyFile = "file"
+)
+
+// BodyCapture limits how much of a response body is kept in memory.
+type BodyCapture struct {
+	mode       string
+	maxSize    int64  // max number of bytes kept in a result, 0 means no limit
+	decodeSize int64  // max number of bytes read to validate or decode a body, 0 means no limit
+	dir        string // directory of body files
+}
+
+// NewBodyCapture returns a reference to a BodyCapture. Bodies exceeding
+// maxSize bytes are truncated in the results. With BodyFile, full bodies are
+// saved to files in dir nevertheless. Only if the body is validated against
+// its content or decoded, up to decodeSize bytes are read.
+func NewBodyCapture(mode string, maxSize, decodeSize int64, dir string) (*BodyCapture, error) {
+	switch mode {
+	case BodyKeep, BodyDiscardSuccess:
+	case BodyFile:
+		if dir == "" {
+			return nil, fmt.Errorf("no directory for body files specified")
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported body capture mode: %s", mode)
+	}
+	if maxSize < 0 {
+		return nil, fmt.Errorf("max body size must be >= 0")
+	}
+	if decodeSize < 0 {
+		return nil, fmt.Errorf("max decoded body size must be >= 0")
+	}
+	return &BodyCapture{
+		mode:       mode,
+		maxSize:    maxSize,
+		decodeSize: decodeSize,
+		dir:        dir,
+	}, nil
+}
+
+// WithBodyCapture uses the provided BodyCapture to read response bodies.
+// Without it, response bodies are read completely into the results.
+func WithBodyCapture(b *BodyCapture) ClientOption {
+	return func(c *HttpClient) {
+		c.bodyCapture = b
+	}
+}
+
+var defaultBodyCapture = &BodyCapture{
+	mode: BodyKeep,
+}
+
+// readLimit returns the max number of bytes of a response body which are
+// read into memory, 0 means no limit. Bodies which are decoded are read up to
+// decodeSize, the results keep at most maxSize bytes of them.
+func (b *BodyCapture) readLimit(decode bool) int64 {
+	if !decode || b.maxSize == 0 || (b.decodeSize != 0 && b.decodeSize <= b.maxSize) {
+		return b.maxSize
+	}
+	return b.decodeSize
+}
+
+// read reads the response body r of the request body reqBody into resp.
+// Without a body file, reading stops after the read limit. Since the
+// remaining body is not drained, the connection will not be reused in this
+// case.
+func (b *BodyCapture) read(r io.Reader, reqBody []byte, decode bool, resp *response) error {
+	limit := b.readLimit(decode)
+	buf := &cappedBuffer{max: limit}
+	if b.mode != BodyFile {
+		if limit > 0 {
+			// we read one more byte to detect truncation
+			r = io.LimitReader(r, limit+1)
+		}
+		_, err := io.Copy(buf, r)
+		b.keep(buf, resp)
+		return err
+	}
+
+	// we use a timestamp and a hash of the request body as file name, so
+	// files of the same message can be related with each other
+	sum := sha256.Sum256(reqBody)
+	name := fmt.Sprintf("%d-%x.body", time.Now().UnixNano(), sum[:8])
+	resp.file = filepath.Join(b.dir, name)
+	f, err := os.Create(resp.file)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.MultiWriter(f, buf), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	b.keep(buf, resp)
+	return err
+}
+
+// keep records the body read into buf in resp. The raw body is kept for
+// validation, the body of the result is truncated to maxSize.
+func (b *BodyCapture) keep(buf *cappedBuffer, resp *response) {
+	resp.raw = buf.b
+	resp.body, resp.truncated = string(buf.b), buf.truncated
+	if b.maxSize > 0 && int64(len(buf.b)) > b.maxSize {
+		resp.body, resp.truncated = string(buf.b[:b.maxSize]), true
+	}
+}
+
+// cappedBuffer keeps the first max bytes written to it. A max of zero means
+// no limit.
+type cappedBuffer struct {
+	b         []byte
+	max       int64
+	truncated bool
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if c.max > 0 && int64(len(c.b)+n) > c.max {
+		p = p[:c.max-int64(len(c.b))]
+		c.truncated = true
+	}
+	c.b = append(c.b, p...)
+	return n, nil
+}
@@ -0,0 +1,190 @@
+package notify_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+var bodyTests = []struct {
+	d    string // description of test case
+	m    string // capture mode
+	s    int64  // max size
+	st   int    // status code of the response
+	resp string // response body
+	body string // expected body in the result
+	tr   bool   // expect truncation
+}{
+	{
+		d:    "expect small body to be kept",
+		m:    notify.BodyKeep,
+		s:    10,
+		st:   http.StatusOK,
+		resp: "success",
+		body: "success",
+	},
+	{
+		d:    "expect large body to be truncated",
+		m:    notify.BodyKeep,
+		s:    10,
+		st:   http.StatusOK,
+		resp: strings.Repeat("a", 100),
+		body: strings.Repeat("a", 10),
+		tr:   true,
+	},
+	{
+		d:    "expect body of successful response to be discarded",
+		m:    notify.BodyDiscardSuccess,
+		st:   http.StatusOK,
+		resp: "success",
+	},
+	{
+		d:    "expect body of failed response to be kept",
+		m:    notify.BodyDiscardSuccess,
+		s:    5,
+		st:   http.StatusInternalServerError,
+		resp: "failed",
+		body: "faile",
+		tr:   true,
+	},
+	{
+		d:    "expect full body to be saved to file",
+		m:    notify.BodyFile,
+		s:    10,
+		st:   http.StatusOK,
+		resp: strings.Repeat("a", 100),
+		body: strings.Repeat("a", 10),
+		tr:   true,
+	},
+}
+
+func TestBodyCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range bodyTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.st)
+				_, _ = w.Write([]byte(tt.resp))
+			}))
+			defer srv.Close()
+
+			bc, err := notify.NewBodyCapture(tt.m, tt.s, 0, dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			c := notify.NewHttpClient(srv.URL, notify.WithBodyCapture(bc))
+			res := c.Post(context.Background(), message.Message{Body: "foo"})
+			if want, got := tt.body, res.Body; want != got {
+				t.Errorf("want body %q got %q", want, got)
+			}
+			if want, got := tt.tr, res.Truncated; want != got {
+				t.Errorf("want truncated %v got %v", want, got)
+			}
+			if tt.m != notify.BodyFile {
+				return
+			}
+			b, err := ioutil.ReadFile(res.BodyFile)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want, got := tt.resp, string(b); want != got {
+				t.Errorf("want body file content %q got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestBodyCaptureValidation(t *testing.T) {
+	// the response exceeds the max size kept in results
+	resp := `{"pad":"` + strings.Repeat("a", 70*1024) + `","ok":true}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(resp))
+	}))
+	defer srv.Close()
+
+	bc, err := notify.NewBodyCapture(notify.BodyKeep, 64*1024, 16*1024*1024, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	v, err := notify.NewValidator(notify.ValidatorOptions{JSONPath: "$.ok == true"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := notify.NewHttpClient(srv.URL, notify.WithBodyCapture(bc), notify.WithValidator(v))
+	res := c.Post(context.Background(), message.Message{Body: "foo"})
+	if res.Err != nil {
+		t.Errorf("unexpected error: %v", res.Err)
+	}
+	if want, got := 64*1024, len(res.Body); want != got {
+		t.Errorf("want body of %d bytes got %d", want, got)
+	}
+}
+
+func TestBodyCaptureDecodeSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("a", 100) + "ok"))
+	}))
+	defer srv.Close()
+
+	v, err := notify.NewValidator(notify.ValidatorOptions{BodyRegex: "ok$"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the body regex sees the body up to the decode size
+	for _, tt := range []struct {
+		s   int64 // max decoded size
+		err bool  // expect validation error
+	}{{0, false}, {200, false}, {50, true}, {5, true}} {
+		bc, err := notify.NewBodyCapture(notify.BodyKeep, 10, tt.s, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		c := notify.NewHttpClient(srv.URL, notify.WithBodyCapture(bc), notify.WithValidator(v))
+		res := c.Post(context.Background(), message.Message{Body: "foo"})
+		if want, got := tt.err, res.Err != nil; want != got {
+			t.Errorf("want error %t with decode size %d got %v", want, tt.s, res.Err)
+		}
+		if want, got := strings.Repeat("a", 10), res.Body; want != got {
+			t.Errorf("want body %q got %q", want, got)
+		}
+	}
+}
+
+func TestBodyCaptureBatchItems(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[200, 500]`))
+	}))
+	defer srv.Close()
+
+	// the body of the successful response is discarded from the results, but
+	// not before it is decoded
+	bc, err := notify.NewBodyCapture(notify.BodyDiscardSuccess, 0, 0, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e, err := notify.NewBatchEncoder(notify.BatchJSON, notify.BatchResultsItems)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := notify.NewHttpClient(srv.URL, notify.WithBodyCapture(bc), notify.WithBatchEncoder(e))
+	res := c.PostBatch(context.Background(), []message.Message{{Body: "foo"}, {Body: "bar"}})
+	if res[0].Err != nil {
+		t.Errorf("unexpected error: %v", res[0].Err)
+	}
+	if res[1].Err == nil {
+		t.Error("expected error")
+	}
+}
@@ -1,27 +1,140 @@
 package notify
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // HttpClient provides a method to send
 // POST requests to a target URL.
 type HttpClient struct {
-	client    *http.Client
-	targetURL string
+	client       *http.Client
+	targetURL    string
+	transport    *swapTransport
+	tlsConfig    *tls.Config
+	compressor   *Compressor
+	batchEncoder *BatchEncoder
+	validator    *Validator
+	bodyCapture  *BodyCapture
+	idempotency  *Idempotency
+
+	resultHeaders []string // response headers reported in results
+
+	middleware []Middleware
+
+	mu sync.RWMutex // guards the reloadable settings
+	reloadable
+}
+
+// reloadable are the settings of a HttpClient which can be replaced while
+// requests are in flight.
+type reloadable struct {
+	signer  *Signer
+	auth    Authenticator
+	headers map[string]string // static request headers
+}
+
+// ClientOption configures a HttpClient.
+type ClientOption func(*HttpClient)
+
+// WithSigner signs each request with the provided Signer.
+func WithSigner(s *Signer) ClientOption {
+	return func(c *HttpClient) {
+		c.signer = s
+	}
+}
+
+// SetSigner replaces the Signer of the HttpClient, nil disables signing. New
+// requests use the new Signer, in-flight requests are not affected.
+func (c *HttpClient) SetSigner(s *Signer) {
+	c.mu.Lock()
+	c.signer = s
+	c.mu.Unlock()
+}
+
+// WithHeaders sets the provided headers on each request. Headers of a message
+// override them.
+func WithHeaders(h map[string]string) ClientOption {
+	return func(c *HttpClient) {
+		c.headers = h
+	}
+}
+
+// SetHeaders replaces the static request headers of the HttpClient. New
+// requests use the new headers, in-flight requests are not affected.
+func (c *HttpClient) SetHeaders(h map[string]string) {
+	c.mu.Lock()
+	c.headers = h
+	c.mu.Unlock()
+}
+
+// settings returns the current reloadable settings.
+func (c *HttpClient) settings() reloadable {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.reloadable
+}
+
+// WithResultHeaders reports the values of the named response headers in the
+// results.
+func WithResultHeaders(names ...string) ClientOption {
+	return func(c *HttpClient) {
+		c.resultHeaders = names
+	}
+}
+
+// Middleware wraps the RoundTripper which sends the requests of a HttpClient.
+// It sees each attempt of a request as it is sent, i.e. compressed, with
+// credentials and signature.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// WithMiddleware wraps the transport with the provided Middleware. The first
+// Middleware is the outermost one.
+func WithMiddleware(m ...Middleware) ClientOption {
+	return func(c *HttpClient) {
+		c.middleware = append(c.middleware, m...)
+	}
 }
 
 // NewHttpClient returns a reference to a HttpClient.
-func NewHttpClient(targetURL string) *HttpClient {
+func NewHttpClient(targetURL string, opts ...ClientOption) *HttpClient {
+	c := &HttpClient{
+		targetURL: targetURL,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.transport = &swapTransport{t: newTransport(c.tlsConfig)}
+	// the middleware stays in place if the transport is swapped
+	var rt http.RoundTripper = c.transport
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		rt = c.middleware[i](rt)
+	}
+	c.client = &http.Client{Transport: rt}
+	return c
+}
+
+// newTransport returns a Transport using the provided TLS configuration.
+func newTransport(tlsConfig *tls.Config) *http.Transport {
 	// we use a custom transport to control the idle connections settings.
 	// thus, we can avoid closing connections to quickly. since we connect
 	// to the same host and port always we save handshakes
-	t := &http.Transport{
+	return &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
 			Timeout:   5 * time.Second,
@@ -31,31 +144,86 @@ func NewHttpClient(targetURL string) *HttpClient {
 		MaxIdleConnsPerHost: 150, // we connect to the same host:post always
 		IdleConnTimeout:     90 * time.Second,
 		TLSHandshakeTimeout: 5 * time.Second,
-	}
-	return &HttpClient{
-		client:    &http.Client{Transport: t},
-		targetURL: targetURL,
+		TLSClientConfig:     tlsConfig,
 	}
 }
 
 // Post sends POST requests to the clients target URL.
-// Responses with a status code between 200-299 are considered successful.
-func (c *HttpClient) Post(ctx context.Context, msg string) PostResult {
-	req, err := http.NewRequest(http.MethodPost, c.targetURL, strings.NewReader(msg))
-	if err != nil {
-		return PostResult{
-			Msg: msg,
-			Err: PostErr{Err: err.Error()},
-		}
+// Responses with a status code between 200-299 are considered successful,
+// unless the client uses a Validator with different criteria.
+func (c *HttpClient) Post(ctx context.Context, m message.Message) PostResult {
+	headers := m.Headers
+	if c.idempotency != nil {
+		headers = c.idempotency.headers(headers, c.idempotency.Key(m))
 	}
-	req = req.WithContext(ctx)
-	req.Header.Set("Content-Type", "text/plain")
+	resp, err := c.post(ctx, []byte(m.Body), "text/plain", headers, false)
+	return resp.result(m, err)
+}
 
-	resp, err := c.client.Do(req)
+// response holds the metadata and the captured body of a response.
+type response struct {
+	url        string
+	start      time.Time
+	attempts   int
+	statusCode int
+	headers    map[string]string // response headers of interest
+	timing     Timing
+	raw        []byte // body as far as it was read, for validation
+	body       string // body kept in the result
+	truncated  bool   // body exceeded the max size
+	file       string // file containing the full body
+}
+
+// result returns the PostResult of m.
+func (r response) result(m message.Message, err error) PostResult {
+	return PostResult{
+		ID:         m.ID,
+		Msg:        m.Body,
+		MsgHeaders: m.Headers,
+		URL:        r.url,
+		StatusCode: r.statusCode,
+		Headers:    r.headers,
+		Attempts:   r.attempts,
+		Start:      r.start,
+		Timing:     r.timing,
+		Body:       r.body,
+		Truncated:  r.truncated,
+		BodyFile:   r.file,
+		Err:        err,
+		Pos:        m.Pos,
+	}
+}
+
+// post sends the body to the clients target URL and returns the response.
+// Transport errors and responses which fail validation result in a PostErr. In
+// the latter case, the response body is returned as well. If the response
+// body is decoded by the caller, decode is true.
+func (c *HttpClient) post(ctx context.Context, body []byte, contentType string, headers map[string]string, decode bool) (response, error) {
+	res := response{
+		url:   c.targetURL,
+		start: time.Now(),
+	}
+	err := c.send(ctx, body, contentType, headers, decode, &res)
+	res.timing.Total = ms(time.Since(res.start))
+	return res, err
+}
+
+// send does the work of post and records the response in res.
+func (c *HttpClient) send(ctx context.Context, body []byte, contentType string, headers map[string]string, decode bool, res *response) error {
+	resp, err := c.do(ctx, body, contentType, headers, res)
 	if err != nil {
-		return PostResult{
-			Msg: msg,
-			Err: PostErr{Err: err.Error()},
+		return newPostErr(err, nil)
+	}
+
+	// receivers reject expired or revoked tokens with 401. if the Authenticator
+	// supports it, we retry once with fresh credentials.
+	if r, ok := c.settings().auth.(refresher); ok && resp.StatusCode == http.StatusUnauthorized {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		r.Invalidate(resp.Request)
+		resp, err = c.do(ctx, body, contentType, headers, res)
+		if err != nil {
+			return newPostErr(err, nil)
 		}
 	}
 
@@ -67,30 +235,100 @@ func (c *HttpClient) Post(ctx context.Context, msg string) PostResult {
 	// still make sure to follow the best practices here.
 	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return PostResult{
-			Msg: msg,
-			Err: PostErr{
-				Err:      err.Error(),
-				Response: resp,
-			},
+	res.statusCode = resp.StatusCode
+	for _, h := range c.resultHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			if res.headers == nil {
+				res.headers = make(map[string]string)
+			}
+			res.headers[h] = v
 		}
 	}
 
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return PostResult{
-			Msg: msg,
-			Err: PostErr{
-				Err:      string(body),
-				Response: resp,
-			},
+	// bodies are validated as far as they are read, no matter how much of
+	// them is kept in the result
+	v := c.validator
+	if v == nil {
+		v = defaultValidator
+	}
+	bc := c.bodyCapture
+	if bc == nil {
+		bc = defaultBodyCapture
+	}
+	if err := bc.read(resp.Body, body, decode || v.decodes(), res); err != nil {
+		return newPostErr(err, resp)
+	}
+	if err := v.Validate(resp, res.raw); err != nil {
+		return newPostErr(err, resp)
+	}
+	if bc.mode == BodyDiscardSuccess {
+		res.body, res.truncated = "", false
+	}
+	return nil
+}
+
+// do creates and sends a single POST request with the provided headers. Each
+// call counts as an attempt and replaces the timing of previous attempts in
+// res.
+func (c *HttpClient) do(ctx context.Context, body []byte, contentType string, headers map[string]string, res *response) (resp *http.Response, err error) {
+	res.attempts++
+	ctx, span := tracing.Tracer().Start(ctx, "POST",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("url.full", c.targetURL),
+			attribute.Int("http.request.resend_count", res.attempts-1),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		}
+		span.End()
+	}()
+
+	var encoding string
+	if c.compressor != nil {
+		var err error
+		body, encoding, err = c.compressor.compress(body)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	// success
-	return PostResult{
-		Msg:  msg,
-		Body: string(body),
+	req, err := http.NewRequest(http.MethodPost, c.targetURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	tr := newTracer()
+	req = req.WithContext(tr.context(ctx))
+	// headers of the message may override the content type and static headers,
+	// but not the encoding, credentials or signature
+	s := c.settings()
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	// receivers can link their traces to the attempt
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if s.auth != nil {
+		if err := s.auth.Authenticate(ctx, req); err != nil {
+			return nil, authError{err}
+		}
+	}
+	// the signature covers the body as sent, so receivers can verify it
+	// before decompressing
+	if s.signer != nil {
+		s.signer.Sign(req, body)
 	}
+	resp, err = c.client.Do(req)
+	res.timing = tr.result()
+	return resp, err
 }
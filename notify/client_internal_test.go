@@ -10,6 +10,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/fgrimme/refurbed/message"
 )
 
 // we test errors first, then success
@@ -127,7 +129,7 @@ func TestPost(t *testing.T) {
 
 			ctx, cancel := context.WithTimeout(context.Background(), tt.t)
 			defer cancel()
-			res := ns.Post(ctx, tt.r.Body)
+			res := ns.Post(ctx, message.Message{Body: tt.r.Body})
 
 			// unexpected errors
 			if res.Err != nil && tt.r.Err == nil {
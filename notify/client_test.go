@@ -0,0 +1,74 @@
+package notify_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+func TestMessageHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want, got := "bar", r.Header.Get("X-Foo"); want != got {
+			t.Errorf("want header %q got %q", want, got)
+		}
+		if want, got := "application/json", r.Header.Get("Content-Type"); want != got {
+			t.Errorf("want content type %q got %q", want, got)
+		}
+	}))
+	defer srv.Close()
+
+	c := notify.NewHttpClient(srv.URL)
+	m := message.Message{
+		ID:      "1",
+		Body:    `{"foo":"bar"}`,
+		Headers: map[string]string{"X-Foo": "bar", "Content-Type": "application/json"},
+	}
+	res := c.Post(context.Background(), m)
+	if res.Err != nil {
+		t.Errorf("unexpected err: %v", res.Err)
+	}
+	if want, got := "bar", res.MsgHeaders["X-Foo"]; want != got {
+		t.Errorf("want message header %q in result got %q", want, got)
+	}
+}
+
+func TestStaticHeaders(t *testing.T) {
+	var headers http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+	}))
+	defer srv.Close()
+
+	c := notify.NewHttpClient(srv.URL,
+		notify.WithHeaders(map[string]string{"X-Foo": "foo", "X-Bar": "bar"}),
+		notify.WithAuth(notify.BearerToken("old")),
+	)
+	m := message.Message{ID: "1", Body: "foo", Headers: map[string]string{"X-Bar": "baz"}}
+	if res := c.Post(context.Background(), m); res.Err != nil {
+		t.Fatalf("unexpected err: %v", res.Err)
+	}
+	if want, got := "foo", headers.Get("X-Foo"); want != got {
+		t.Errorf("want header %q got %q", want, got)
+	}
+	// headers of the message override static headers
+	if want, got := "baz", headers.Get("X-Bar"); want != got {
+		t.Errorf("want header %q got %q", want, got)
+	}
+
+	// reloaded settings apply to new requests
+	c.SetHeaders(map[string]string{"X-Foo": "qux"})
+	c.SetAuth(notify.BearerToken("new"))
+	if res := c.Post(context.Background(), m); res.Err != nil {
+		t.Fatalf("unexpected err: %v", res.Err)
+	}
+	if want, got := "qux", headers.Get("X-Foo"); want != got {
+		t.Errorf("want header %q got %q", want, got)
+	}
+	if want, got := "Bearer new", headers.Get("Authorization"); want != got {
+		t.Errorf("want authorization %q got %q", want, got)
+	}
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// content encodings supported by the Compressor.
+const (
+	CompressionGzip    = "gzip"
+	CompressionDeflate = "deflate" // zlib format, see RFC 7230 section 4.2.2
+	CompressionZstd    = "zstd"
+)
+
+// Compressor compresses request bodies which exceed a size threshold.
+type Compressor struct {
+	encoding  string
+	threshold int
+	writers   sync.Pool // gzip and zlib writers are expensive to allocate
+	zstd      *zstd.Encoder
+}
+
+// NewCompressor returns a reference to a Compressor. Bodies smaller than
+// threshold bytes are sent uncompressed.
+func NewCompressor(encoding string, threshold int) (*Compressor, error) {
+	c := &Compressor{
+		encoding:  encoding,
+		threshold: threshold,
+	}
+	switch encoding {
+	case CompressionGzip:
+		c.writers.New = func() interface{} { return gzip.NewWriter(nil) }
+	case CompressionDeflate:
+		c.writers.New = func() interface{} { return zlib.NewWriter(nil) }
+	case CompressionZstd:
+		// EncodeAll is safe for concurrent use
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		c.zstd = enc
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", encoding)
+	}
+	return c, nil
+}
+
+// WithCompression compresses request bodies with the provided Compressor.
+func WithCompression(c *Compressor) ClientOption {
+	return func(hc *HttpClient) {
+		hc.compressor = c
+	}
+}
+
+// compress returns the compressed body and the content encoding. If body is
+// smaller than the threshold, it is returned unchanged with an empty encoding.
+func (c *Compressor) compress(body []byte) ([]byte, string, error) {
+	if len(body) < c.threshold {
+		return body, "", nil
+	}
+	if c.zstd != nil {
+		return c.zstd.EncodeAll(body, nil), c.encoding, nil
+	}
+
+	type resetWriter interface {
+		io.WriteCloser
+		Reset(io.Writer)
+	}
+	w := c.writers.Get().(resetWriter)
+	defer c.writers.Put(w)
+
+	var buf bytes.Buffer
+	w.Reset(&buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), c.encoding, nil
+}
@@ -0,0 +1,102 @@
+package notify_test
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/klauspost/compress/zstd"
+)
+
+var compressTests = []struct {
+	d string // description of test case
+	c string // compression
+	m string // message
+	e string // expected content encoding
+}{
+	{
+		d: "expect small message to be sent uncompressed",
+		c: notify.CompressionGzip,
+		m: "foo",
+	},
+	{
+		d: "expect gzip compression above threshold",
+		c: notify.CompressionGzip,
+		m: strings.Repeat("foo", 100),
+		e: "gzip",
+	},
+	{
+		d: "expect deflate compression above threshold",
+		c: notify.CompressionDeflate,
+		m: strings.Repeat("foo", 100),
+		e: "deflate",
+	},
+	{
+		d: "expect zstd compression above threshold",
+		c: notify.CompressionZstd,
+		m: strings.Repeat("foo", 100),
+		e: "zstd",
+	},
+}
+
+func TestCompression(t *testing.T) {
+	for _, tc := range compressTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if want, got := tt.e, r.Header.Get("Content-Encoding"); want != got {
+					t.Errorf("want content encoding %q got %q", want, got)
+				}
+				var body io.Reader
+				var err error
+				switch tt.e {
+				case "gzip":
+					body, err = gzip.NewReader(r.Body)
+				case "deflate":
+					body, err = zlib.NewReader(r.Body)
+				case "zstd":
+					var d *zstd.Decoder
+					d, err = zstd.NewReader(r.Body)
+					if err == nil {
+						defer d.Close()
+					}
+					body = d
+				default:
+					body = r.Body
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := ioutil.ReadAll(body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want, got := tt.m, string(b); want != got {
+					t.Errorf("want body %q got %q", want, got)
+				}
+			}))
+			defer srv.Close()
+
+			comp, err := notify.NewCompressor(tt.c, 100)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			c := notify.NewHttpClient(srv.URL, notify.WithCompression(comp))
+			if res := c.Post(context.Background(), message.Message{Body: tt.m}); res.Err != nil {
+				t.Errorf("unexpected err: %v", res.Err)
+			}
+		})
+	}
+
+	if _, err := notify.NewCompressor("br", 0); err == nil {
+		t.Error("expect error for unsupported compression")
+	}
+}
@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// error classes of results.
+const (
+	ErrClassTimeout           = "timeout"
+	ErrClassCanceled          = "canceled"
+	ErrClassConnectionRefused = "connection_refused"
+	ErrClassConnection        = "connection" // other transport errors, e.g. reset connections
+	ErrClassDNS               = "dns"
+	ErrClassTLS               = "tls"
+	ErrClassAuth              = "auth"
+	ErrClassHTTPStatus        = "http_status"
+	ErrClassValidation        = "validation"
+	ErrClassUnknown           = "unknown"
+)
+
+// ErrorInfo is the representation of an error in the results.
+type ErrorInfo struct {
+	Class     string `json:"class"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+// statusError is returned by a Validator if the status code is not accepted.
+type statusError struct {
+	code int
+	body []byte
+}
+
+func (e statusError) Error() string {
+	return string(e.body)
+}
+
+// validationError is returned by a Validator if a criterion other than the
+// status code is not met.
+type validationError struct {
+	msg string
+}
+
+func (e validationError) Error() string {
+	return e.msg
+}
+
+// authError is returned if an Authenticator fails to provide credentials.
+type authError struct {
+	err error
+}
+
+func (e authError) Error() string {
+	return e.err.Error()
+}
+
+func (e authError) Unwrap() error {
+	return e.err
+}
+
+// newPostErr returns a PostErr for err which occurred while posting. The
+// response is nil for errors on the transport layer.
+func newPostErr(err error, resp *http.Response) PostErr {
+	info := Classify(err)
+	return PostErr{
+		Err:       err.Error(),
+		Class:     info.Class,
+		Retryable: info.Retryable,
+		Response:  resp,
+		cause:     err,
+	}
+}
+
+// Classify returns the class of err and whether a request which failed with
+// err can be retried. Errors are classified consistently, no matter if they
+// originate from a HttpClient or from another PostClient.
+func Classify(err error) ErrorInfo {
+	info := ErrorInfo{
+		Class:   ErrClassUnknown,
+		Message: err.Error(),
+	}
+
+	var pe PostErr
+	if errors.As(err, &pe) && pe.Class != "" {
+		info.Class, info.Retryable = pe.Class, pe.Retryable
+		return info
+	}
+
+	var (
+		se  statusError
+		ve  validationError
+		ae  authError
+		dns *net.DNSError
+		ne  net.Error
+		ue  x509.UnknownAuthorityError
+		he  x509.HostnameError
+		ce  x509.CertificateInvalidError
+		re  tls.RecordHeaderError
+		tae tls.AlertError
+	)
+	switch {
+	case errors.As(err, &se):
+		info.Class, info.Retryable = ErrClassHTTPStatus, retryableStatus(se.code)
+	case errors.As(err, &ve):
+		info.Class = ErrClassValidation
+	case errors.As(err, &ae):
+		info.Class, info.Retryable = ErrClassAuth, true
+	case errors.Is(err, context.Canceled):
+		info.Class = ErrClassCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		info.Class, info.Retryable = ErrClassTimeout, true
+	case errors.As(err, &dns):
+		// unknown hosts are unlikely to appear on retry
+		info.Class, info.Retryable = ErrClassDNS, !dns.IsNotFound
+	case errors.As(err, &ue), errors.As(err, &he), errors.As(err, &ce),
+		errors.As(err, &re), errors.As(err, &tae), errors.Is(err, ErrPinMismatch):
+		info.Class = ErrClassTLS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		info.Class, info.Retryable = ErrClassConnectionRefused, true
+	case errors.As(err, &ne) && ne.Timeout():
+		info.Class, info.Retryable = ErrClassTimeout, true
+	case errors.As(err, &ne), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		info.Class, info.Retryable = ErrClassConnection, true
+	}
+	return info
+}
+
+// retryableStatus reports whether a request which was answered with the
+// status code may succeed on retry.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	}
+	return code >= 500
+}
@@ -0,0 +1,156 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+var classifyTests = []struct {
+	d string // description of test case
+	e error  // error to classify
+	c string // expected class
+	r bool   // expect retryable
+}{
+	{
+		d: "expect deadline exceeded to be a retryable timeout",
+		e: context.DeadlineExceeded,
+		c: notify.ErrClassTimeout,
+		r: true,
+	},
+	{
+		d: "expect wrapped cancelation to be classified",
+		e: &url.Error{Op: "Post", URL: "http://localhost", Err: context.Canceled},
+		c: notify.ErrClassCanceled,
+	},
+	{
+		d: "expect unknown errors to be classified as unknown",
+		e: errors.New("foo"),
+		c: notify.ErrClassUnknown,
+	},
+}
+
+func TestClassify(t *testing.T) {
+	for _, tc := range classifyTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			info := notify.Classify(tt.e)
+			if want, got := tt.c, info.Class; want != got {
+				t.Errorf("want class %s got %s", want, got)
+			}
+			if want, got := tt.r, info.Retryable; want != got {
+				t.Errorf("want retryable %v got %v", want, got)
+			}
+			if want, got := tt.e.Error(), info.Message; want != got {
+				t.Errorf("want message %q got %q", want, got)
+			}
+		})
+	}
+}
+
+var postErrorTests = []struct {
+	d string                  // description of test case
+	s int                     // status code of the response
+	o notify.ValidatorOptions // success criteria
+	w time.Duration           // response delay
+	c string                  // expected class
+	r bool                    // expect retryable
+}{
+	{
+		d: "expect 503 to be a retryable status error",
+		s: http.StatusServiceUnavailable,
+		c: notify.ErrClassHTTPStatus,
+		r: true,
+	},
+	{
+		d: "expect 400 to be a permanent status error",
+		s: http.StatusBadRequest,
+		c: notify.ErrClassHTTPStatus,
+	},
+	{
+		d: "expect failed body assertion to be a validation error",
+		s: http.StatusOK,
+		o: notify.ValidatorOptions{JSONPath: "$.ok == true"},
+		c: notify.ErrClassValidation,
+	},
+	{
+		d: "expect request timeout to be a retryable timeout",
+		s: http.StatusOK,
+		w: 100 * time.Millisecond,
+		c: notify.ErrClassTimeout,
+		r: true,
+	},
+}
+
+func TestPostErrors(t *testing.T) {
+	for _, tc := range postErrorTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(tt.w)
+				w.WriteHeader(tt.s)
+				_, _ = w.Write([]byte(`{"ok": false}`))
+			}))
+			defer srv.Close()
+
+			v, err := notify.NewValidator(tt.o)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			c := notify.NewHttpClient(srv.URL, notify.WithValidator(v))
+			res := c.Post(ctx, message.Message{Body: "foo"})
+			if res.Err == nil {
+				t.Fatal("expected err")
+			}
+			info := notify.Classify(res.Err)
+			if want, got := tt.c, info.Class; want != got {
+				t.Errorf("want class %s got %s", want, got)
+			}
+			if want, got := tt.r, info.Retryable; want != got {
+				t.Errorf("want retryable %v got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestPostConnectionRefused(t *testing.T) {
+	// the server is closed so the port does not accept connections
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close()
+
+	res := notify.NewHttpClient(srv.URL).Post(context.Background(), message.Message{Body: "foo"})
+	if want, got := notify.ErrClassConnectionRefused, notify.Classify(res.Err).Class; want != got {
+		t.Errorf("want class %s got %s", want, got)
+	}
+}
+
+func TestMarshalResultError(t *testing.T) {
+	// errors which are not a PostErr would marshal as {} otherwise
+	b, err := json.Marshal(notify.PostResult{ID: "1", Msg: "foo", Err: context.DeadlineExceeded})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `"error":{"class":"timeout","message":"context deadline exceeded","retryable":true}`
+	if got := string(b); !strings.Contains(got, want) {
+		t.Errorf("want result to contain\n%s\ngot\n%s", want, got)
+	}
+
+	b, err = json.Marshal(notify.PostResult{ID: "1", Msg: "foo"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := string(b); !strings.Contains(got, `"error":null`) {
+		t.Errorf("want result without error, got\n%s", got)
+	}
+}
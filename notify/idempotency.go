@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fgrimme/refurbed/message"
+)
+
+// DefaultIdempotencyHeader is the default name of the idempotency key header.
+const DefaultIdempotencyHeader = "Idempotency-Key"
+
+// sources of idempotency keys.
+const (
+	KeyFromID   = "id"   // the message ID
+	KeyFromHash = "hash" // the SHA-256 hash of the message body
+)
+
+// Idempotency derives an idempotency key from each message and sends it in a
+// header, so receivers can detect messages they received before. The key
+// only depends on the message, so it is the same for all attempts of a
+// request, for replays and for resumed runs. Batch requests carry a key of
+// the batch, which is not, see batchKey.
+type Idempotency struct {
+	header string
+	source string
+}
+
+// NewIdempotency returns a reference to an Idempotency. An empty header is
+// replaced by DefaultIdempotencyHeader.
+func NewIdempotency(header, source string) (*Idempotency, error) {
+	if header == "" {
+		header = DefaultIdempotencyHeader
+	}
+	switch source {
+	case KeyFromID, KeyFromHash:
+	default:
+		return nil, fmt.Errorf("unsupported idempotency key source: %s", source)
+	}
+	return &Idempotency{header: header, source: source}, nil
+}
+
+// WithIdempotency sends an idempotency key with each request.
+func WithIdempotency(i *Idempotency) ClientOption {
+	return func(c *HttpClient) {
+		c.idempotency = i
+	}
+}
+
+// Key returns the idempotency key of m. Messages without an ID use the hash
+// of their body.
+func (i *Idempotency) Key(m message.Message) string {
+	if i.source == KeyFromID && m.ID != "" {
+		return m.ID
+	}
+	sum := sha256.Sum256([]byte(m.Body))
+	return hex.EncodeToString(sum[:])
+}
+
+// batchKey returns the idempotency key of a batch, the hash of the keys of
+// its messages. Batches are cut by count, size and time, so the messages of
+// a resumed run, a spool or a replay may be batched differently. The key is
+// only stable across the retries of one request.
+func (i *Idempotency) batchKey(msgs []message.Message) string {
+	keys := make([]string, len(msgs))
+	for n, m := range msgs {
+		keys[n] = i.Key(m)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// headers returns the headers of a request with the key added. A key set in
+// the headers of the message is kept.
+func (i *Idempotency) headers(h map[string]string, key string) map[string]string {
+	out := make(map[string]string, len(h)+1)
+	for k, v := range h {
+		if http.CanonicalHeaderKey(k) == http.CanonicalHeaderKey(i.header) {
+			return h
+		}
+		out[k] = v
+	}
+	out[i.header] = key
+	return out
+}
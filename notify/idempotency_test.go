@@ -0,0 +1,125 @@
+package notify_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+const fooHash = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae" // SHA-256 of "foo"
+
+var idempotencyTests = []struct {
+	d string          // description of test case
+	h string          // header name
+	s string          // key source
+	m message.Message // message
+	k string          // expected key
+}{
+	{
+		d: "expect message ID as key",
+		s: notify.KeyFromID,
+		m: message.Message{ID: "order-42", Body: "foo"},
+		k: "order-42",
+	},
+	{
+		d: "expect body hash as key",
+		s: notify.KeyFromHash,
+		m: message.Message{ID: "order-42", Body: "foo"},
+		k: fooHash,
+	},
+	{
+		d: "expect body hash as key of messages without ID",
+		s: notify.KeyFromID,
+		m: message.Message{Body: "foo"},
+		k: fooHash,
+	},
+	{
+		d: "expect key of the message to be kept",
+		s: notify.KeyFromID,
+		m: message.Message{ID: "order-42", Body: "foo", Headers: map[string]string{"idempotency-key": "custom"}},
+		k: "custom",
+	},
+	{
+		d: "expect custom header",
+		h: "X-Request-Id",
+		s: notify.KeyFromID,
+		m: message.Message{ID: "order-42", Body: "foo"},
+		k: "order-42",
+	},
+}
+
+func TestIdempotency(t *testing.T) {
+	for _, tc := range idempotencyTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			header := tt.h
+			if header == "" {
+				header = notify.DefaultIdempotencyHeader
+			}
+			var (
+				mu   sync.Mutex
+				keys []string
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				keys = append(keys, r.Header.Get(header))
+			}))
+			defer srv.Close()
+
+			i, err := notify.NewIdempotency(tt.h, tt.s)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			// the message is sent twice, like by a replay
+			c := notify.NewHttpClient(srv.URL, notify.WithIdempotency(i))
+			for n := 0; n < 2; n++ {
+				if res := c.Post(context.Background(), tt.m); res.Err != nil {
+					t.Fatalf("unexpected err: %v", res.Err)
+				}
+			}
+			if want, got := 2, len(keys); want != got {
+				t.Fatalf("want %d requests got %d", want, got)
+			}
+			for _, key := range keys {
+				if want, got := tt.k, key; want != got {
+					t.Errorf("want key %q got %q", want, got)
+				}
+			}
+		})
+	}
+
+	if _, err := notify.NewIdempotency("", "uuid"); err == nil {
+		t.Error("expected error for unsupported key source")
+	}
+}
+
+func TestIdempotencyBatch(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(notify.DefaultIdempotencyHeader))
+	}))
+	defer srv.Close()
+
+	i, err := notify.NewIdempotency("", notify.KeyFromID)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	c := notify.NewHttpClient(srv.URL, notify.WithIdempotency(i))
+	a := []message.Message{{ID: "1", Body: "foo"}, {ID: "2", Body: "bar"}}
+	b := []message.Message{{ID: "1", Body: "foo"}}
+	for _, batch := range [][]message.Message{a, a, b} {
+		c.PostBatch(context.Background(), batch)
+	}
+	if keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("want the same key for the same batch got %q and %q", keys[0], keys[1])
+	}
+	if keys[0] == keys[2] {
+		t.Errorf("want different keys for different batches got %q", keys[2])
+	}
+}
@@ -0,0 +1,62 @@
+package notify
+
+import "sync"
+
+// limiter limits the number of concurrent requests. Unlike a semaphore
+// channel, its limit can be changed while requests are in flight.
+type limiter struct {
+	sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+func newLimiter(limit int) *limiter {
+	l := &limiter{limit: limit}
+	l.cond = sync.NewCond(&l.Mutex)
+	return l
+}
+
+// acquire blocks until a request may start.
+func (l *limiter) acquire() {
+	l.Lock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+	l.Unlock()
+}
+
+// release marks a request as done.
+func (l *limiter) release() {
+	l.Lock()
+	l.active--
+	l.Unlock()
+	l.cond.Broadcast()
+}
+
+// resize changes the limit. If the limit shrinks, requests in flight are
+// not affected, but no request starts until the number of active requests
+// is below the new limit.
+func (l *limiter) resize(limit int) {
+	l.Lock()
+	l.limit = limit
+	l.Unlock()
+	l.cond.Broadcast()
+}
+
+// size returns the limit.
+func (l *limiter) size() int {
+	l.Lock()
+	defer l.Unlock()
+	return l.limit
+}
+
+// wait blocks until all requests are done.
+func (l *limiter) wait() {
+	l.Lock()
+	for l.active > 0 {
+		l.cond.Wait()
+	}
+	l.Unlock()
+}
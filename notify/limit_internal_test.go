@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(2)
+	l.acquire()
+	l.acquire()
+
+	// a third request waits until the limit grows
+	started := make(chan struct{})
+	go func() {
+		l.acquire()
+		close(started)
+	}()
+	select {
+	case <-started:
+		t.Fatal("unexpected request above the limit")
+	case <-time.After(10 * time.Millisecond):
+	}
+	l.resize(3)
+	<-started
+
+	// wait returns after all requests are released
+	var wg sync.WaitGroup
+	wg.Add(1)
+	done := make(chan struct{})
+	go func() {
+		wg.Done()
+		l.wait()
+		close(done)
+	}()
+	wg.Wait()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-done:
+			t.Fatalf("unexpected return of wait with %d active requests", 3-i)
+		default:
+		}
+		l.release()
+	}
+	<-done
+	if want, got := 3, l.size(); want != got {
+		t.Errorf("want limit %d got %d", want, got)
+	}
+}
@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/fgrimme/refurbed/message"
+)
+
+// KeyFunc returns the ordering key of a message. Messages with the same
+// non-empty key are sent sequentially in input order, see Service.OrderBy.
+type KeyFunc func(m message.Message) string
+
+// JSONKey returns a KeyFunc which uses the value at a JSONPath of the message
+// body, e.g. $.order.id. Messages which are not JSON or lack the value have no
+// key.
+func JSONKey(path string) (KeyFunc, error) {
+	segs, err := parseJSONPath(strings.TrimSpace(path))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, path)
+	}
+	return func(m message.Message) string {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(m.Body), &doc); err != nil {
+			return ""
+		}
+		v, found := lookupJSONPath(doc, segs)
+		if !found || v == nil {
+			return ""
+		}
+		if s, ok := v.(string); ok {
+			return s
+		}
+		b, _ := json.Marshal(v) // decoded values can always be encoded
+		return string(b)
+	}, nil
+}
+
+// RegexKey returns a KeyFunc which uses the first capture group of a regular
+// expression matching the message body, or the whole match if the expression
+// has no group. Messages which do not match have no key.
+func RegexKey(expr string) (KeyFunc, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(m message.Message) string {
+		match := re.FindStringSubmatch(m.Body)
+		if match == nil {
+			return ""
+		}
+		if len(match) > 1 {
+			return match[1]
+		}
+		return match[0]
+	}, nil
+}
+
+// keyed serializes posts with the same key. A post with a key which is
+// busy waits in the line of the key and is sent by the goroutine of the post
+// before it.
+type keyed struct {
+	sync.Mutex
+	lines map[string][]post // waiting posts by busy key
+}
+
+// enqueue adds p to the line of its key and reports whether the key was busy.
+// If not, the caller must send p and call next once it returned.
+func (k *keyed) enqueue(p post) bool {
+	k.Lock()
+	defer k.Unlock()
+	line, busy := k.lines[p.key]
+	if busy {
+		k.lines[p.key] = append(line, p)
+		return true
+	}
+	k.lines[p.key] = nil
+	return false
+}
+
+// next returns the next post of the key. If there is none, the key is no
+// longer busy.
+func (k *keyed) next(key string) (post, bool) {
+	k.Lock()
+	defer k.Unlock()
+	line := k.lines[key]
+	if len(line) == 0 {
+		delete(k.lines, key)
+		return post{}, false
+	}
+	p := line[0]
+	line[0] = post{} // release the post for the garbage collector
+	k.lines[key] = line[1:]
+	return p, true
+}
@@ -0,0 +1,156 @@
+package notify_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/rs/zerolog"
+)
+
+var keyTests = []struct {
+	d string // description of test case
+	j string // JSONPath
+	r string // regular expression
+	b string // message body
+	k string // expected key
+}{
+	{
+		d: "expect string value as key",
+		j: "$.order.id",
+		b: `{"order":{"id":"42"}}`,
+		k: "42",
+	},
+	{
+		d: "expect encoded value as key",
+		j: "$.order.id",
+		b: `{"order":{"id":42}}`,
+		k: "42",
+	},
+	{
+		d: "expect no key for missing value",
+		j: "$.order.id",
+		b: `{"order":{}}`,
+	},
+	{
+		d: "expect no key for text",
+		j: "$.order.id",
+		b: `order 42`,
+	},
+	{
+		d: "expect capture group as key",
+		r: `order (\d+)`,
+		b: `order 42 shipped`,
+		k: "42",
+	},
+	{
+		d: "expect match as key",
+		r: `order \d+`,
+		b: `order 42 shipped`,
+		k: "order 42",
+	},
+	{
+		d: "expect no key without match",
+		r: `order (\d+)`,
+		b: `invoice 42`,
+	},
+}
+
+func TestKeyFunc(t *testing.T) {
+	for _, tc := range keyTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			var (
+				key notify.KeyFunc
+				err error
+			)
+			if tt.j != "" {
+				key, err = notify.JSONKey(tt.j)
+			} else {
+				key, err = notify.RegexKey(tt.r)
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want, got := tt.k, key(message.Message{Body: tt.b}); want != got {
+				t.Errorf("want key %q got %q", want, got)
+			}
+		})
+	}
+}
+
+// orderClient is a mock client which records the order of the messages per
+// key and detects concurrent messages of a key.
+type orderClient struct {
+	sync.Mutex
+	sent    map[string][]int // message numbers by key
+	busy    map[string]bool
+	overlap bool
+}
+
+func (oc *orderClient) Post(ctx context.Context, m message.Message) notify.PostResult {
+	var key string
+	var n int
+	fmt.Sscanf(m.Body, "%s %d", &key, &n)
+	oc.Lock()
+	if oc.busy[key] {
+		oc.overlap = true
+	}
+	oc.busy[key] = true
+	oc.sent[key] = append(oc.sent[key], n)
+	oc.Unlock()
+
+	time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+
+	oc.Lock()
+	oc.busy[key] = false
+	oc.Unlock()
+	return notify.PostResult{Msg: m.Body}
+}
+
+func TestOrderBy(t *testing.T) {
+	client := &orderClient{sent: make(map[string][]int), busy: make(map[string]bool)}
+	s, err := notify.NewService(client, time.Second, 4, zerolog.New(ioutil.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key, err := notify.RegexKey(`^(\w+)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.OrderBy(key)
+
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	queue := make(chan message.Message)
+	go func() {
+		for n := 0; n < 60; n++ {
+			queue <- message.Message{Body: fmt.Sprintf("%s %d", keys[n%len(keys)], n)}
+		}
+		close(queue)
+	}()
+	var results int
+	for range s.Run(context.Background(), queue) {
+		results++
+	}
+	if want, got := 60, results; want != got {
+		t.Errorf("want %d results got %d", want, got)
+	}
+	if client.overlap {
+		t.Error("unexpected concurrent messages with the same key")
+	}
+	for _, k := range keys {
+		sent := client.sent[k]
+		for i := 1; i < len(sent); i++ {
+			if sent[i] < sent[i-1] {
+				t.Errorf("want messages of key %s in order got %v", k, sent)
+				break
+			}
+		}
+	}
+}
@@ -3,22 +3,31 @@ package notify
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync/atomic"
 	"time"
 
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/tracing"
 	"github.com/rs/zerolog"
 )
 
 type PostClient interface {
-	Post(ctx context.Context, msg string) PostResult
+	Post(ctx context.Context, m message.Message) PostResult
 }
 
 // Service reads from an input queue and post messages to a PostClient.
-// Post calls run in parallel, limited by the Schedulers concurrency setting.
+// Post calls run in parallel, limited by a concurrency limit which can be
+// changed with SetConcurrency.
 type Service struct {
 	client      PostClient
+	batchClient BatchClient
 	timeout     time.Duration
-	concurrency int // must be greater than 0
+	limit       *limiter
+	key         KeyFunc // orders messages by key, if set
 	logger      zerolog.Logger
+
+	inFlight int64 // requests which have not returned yet
 }
 
 // NewService returns a reference to a Service.
@@ -27,54 +36,184 @@ func NewService(c PostClient, timeout time.Duration, concurrency int, logger zer
 		return nil, errors.New("concurrency must be > 0")
 	}
 	return &Service{
-		client:      c,
-		concurrency: concurrency,
+		client:  c,
+		limit:   newLimiter(concurrency),
+		timeout: timeout,
+		logger:  logger,
+	}, nil
+}
+
+// NewBatchService returns a reference to a Service which posts batches of
+// messages to a BatchClient. Use RunBatches to start it.
+func NewBatchService(c BatchClient, timeout time.Duration, concurrency int, logger zerolog.Logger) (*Service, error) {
+	if concurrency < 1 {
+		return nil, errors.New("concurrency must be > 0")
+	}
+	return &Service{
+		batchClient: c,
+		limit:       newLimiter(concurrency),
 		timeout:     timeout,
 		logger:      logger,
 	}, nil
 }
 
+// post is a single request which results in one or more PostResults. Posts
+// with the same non-empty key are sent sequentially.
+type post struct {
+	key  string
+	send func(ctx context.Context) []PostResult
+}
+
+// OrderBy sends messages with the same key sequentially in input order,
+// including their retries. Messages with different keys or without a key are
+// sent concurrently up to the concurrency limit. A key waiting for its
+// previous message holds no slot of the limit. OrderBy must be called before
+// Run, it does not apply to RunBatches.
+func (s *Service) OrderBy(key KeyFunc) {
+	s.key = key
+}
+
 // Run starts the event loop of the Service.
 // It reads messages from the provided inbound channel until it gets closed. The
 // retrieved messages are posted to the Service's PostClient. Results of the post
 // calls get send to the outbound channel.
 // When the inbound channel is closed, the function stops posting and waits until
 // all post requests have returned before closing the outbound channel.
-// Post calls can be canceled by the provided Context. A derived Context is used
-// to set a deadline to the post calls.
-func (s *Service) Run(ctx context.Context, queue chan string) chan PostResult {
-	limit := make(chan struct{}, s.concurrency)
+// Post calls can be canceled by the provided Context. If it is canceled with a
+// cause, the errors of the canceled post calls wrap the cause. A derived
+// Context is used to set a deadline to the post calls.
+func (s *Service) Run(ctx context.Context, queue chan message.Message) chan PostResult {
+	posts := make(chan post)
+	go func() {
+		defer close(posts)
+		for msg := range queue {
+			if msg.Body == "" {
+				continue
+			}
+			// we explicitly copy msg here to avoid sharing the loop variable
+			msg := msg
+			p := post{send: func(ctx context.Context) []PostResult {
+				msg := tracing.Stage(msg, "notify")
+				res := s.client.Post(tracing.Context(ctx, msg), msg)
+				tracing.End(msg, res.Err)
+				return []PostResult{res}
+			}}
+			if s.key != nil {
+				p.key = s.key(msg)
+			}
+			posts <- p
+		}
+	}()
+	return s.run(ctx, posts)
+}
+
+// RunBatches works like Run but reads batches of messages which are posted to
+// the Service's BatchClient. One PostResult per message is sent to the
+// outbound channel. Each batch request counts against the concurrency limit
+// once.
+func (s *Service) RunBatches(ctx context.Context, batches chan []message.Message) chan PostResult {
+	posts := make(chan post)
+	go func() {
+		defer close(posts)
+		for batch := range batches {
+			if len(batch) == 0 {
+				continue
+			}
+			batch := batch
+			posts <- post{send: func(ctx context.Context) []PostResult {
+				for i := range batch {
+					batch[i] = tracing.Stage(batch[i], "notify")
+				}
+				ctx, span := tracing.Batch(ctx, batch)
+				results := s.batchClient.PostBatch(ctx, batch)
+				span.End()
+				for i, res := range results {
+					if i < len(batch) {
+						tracing.End(batch[i], res.Err)
+					}
+				}
+				return results
+			}}
+		}
+	}()
+	return s.run(ctx, posts)
+}
+
+func (s *Service) run(ctx context.Context, posts chan post) chan PostResult {
 	out := make(chan PostResult)
 
+	keys := &keyed{lines: make(map[string][]post)}
 	s.logger.Info().Msg("start notification service")
 	go func() {
-		for msg := range queue {
-			if msg == "" {
+		for p := range posts {
+			// a post with a busy key is sent after the posts before it
+			if p.key != "" && keys.enqueue(p) {
 				continue
 			}
-
 			// limit concurrency
-			limit <- struct{}{}
+			s.limit.acquire()
 
 			// we explicitly pass the args here to avoid shadowing
-			go func(ctx context.Context, msg string) {
-				ctx, cancel := context.WithTimeout(ctx, s.timeout)
-				out <- s.client.Post(ctx, msg)
-				<-limit
-				cancel()
-			}(ctx, msg)
+			go func(ctx context.Context, p post) {
+				for {
+					s.send(ctx, p, out)
+					if p.key == "" {
+						break
+					}
+					var ok bool
+					if p, ok = keys.next(p.key); !ok {
+						break
+					}
+				}
+				s.limit.release()
+			}(ctx, p)
 		}
 
 		s.logger.Info().Str("term", "FIN").Msg("stop notification service")
 
 		// wait until all requests have returned
 		// before closing the outbound channel
-		for i := 0; i < s.concurrency; i++ {
-			limit <- struct{}{}
-		}
+		s.limit.wait()
 		close(out)
-		close(limit)
 	}()
 
 	return out
 }
+
+// send sends p with the request timeout and sends its results to out.
+func (s *Service) send(ctx context.Context, p post, out chan PostResult) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	atomic.AddInt64(&s.inFlight, 1)
+	results := p.send(ctx)
+	atomic.AddInt64(&s.inFlight, -1)
+	cause := context.Cause(ctx)
+	for _, res := range results {
+		if cause != nil && cause != context.Canceled && errors.Is(res.Err, context.Canceled) {
+			res.Err = fmt.Errorf("%w: %w", cause, res.Err)
+		}
+		out <- res
+	}
+}
+
+// InFlight returns the number of requests which have not returned yet.
+func (s *Service) InFlight() int {
+	return int(atomic.LoadInt64(&s.inFlight))
+}
+
+// Concurrency returns the max number of concurrent requests.
+func (s *Service) Concurrency() int {
+	return s.limit.size()
+}
+
+// SetConcurrency changes the max number of concurrent requests. It is safe to
+// call while requests are in flight. If the limit shrinks, no request is
+// canceled, but new requests wait until enough requests have returned.
+func (s *Service) SetConcurrency(n int) error {
+	if n < 1 {
+		return errors.New("concurrency must be > 0")
+	}
+	s.limit.resize(n)
+	s.logger.Info().Int("concurrency", n).Msg("set concurrency")
+	return nil
+}
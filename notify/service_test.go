@@ -2,11 +2,14 @@ package notify_test
 
 import (
 	"context"
+	"errors"
 	"io/ioutil"
 	"log"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/fgrimme/refurbed/message"
 	"github.com/fgrimme/refurbed/notify"
 	"github.com/rs/zerolog"
 	"go.uber.org/goleak"
@@ -19,8 +22,8 @@ const timeout = 100 * time.Millisecond // request timeout
 type postClient struct{}
 
 // we use the msg parameter to get the return value from the test cases.
-func (pc *postClient) Post(ctx context.Context, msg string) notify.PostResult {
-	tc := serviceTests[string(msg)]
+func (pc *postClient) Post(ctx context.Context, m message.Message) notify.PostResult {
+	tc := serviceTests[m.Body]
 	if tc.t { // test timeout
 		time.Sleep(timeout + 10*time.Millisecond)
 	}
@@ -86,12 +89,12 @@ func TestRun(t *testing.T) {
 	// we use the context to signal requests to return
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	defer cancelFunc()
-	queue := make(chan string, 10)
+	queue := make(chan message.Message, 10)
 	out := s.Run(ctx, queue)
 
 	// send the test messages to the queue
 	for _, tc := range serviceTests {
-		queue <- tc.r.Body
+		queue <- message.Message{Body: tc.r.Body}
 	}
 	// note, not closing the queue will result in an inifite loop
 	close(queue)
@@ -123,6 +126,116 @@ func TestRun(t *testing.T) {
 	}
 }
 
+// blockClient is a mock client which blocks requests until they are canceled.
+type blockClient struct{}
+
+func (blockClient) Post(ctx context.Context, m message.Message) notify.PostResult {
+	<-ctx.Done()
+	return notify.PostResult{Msg: m.Body, Err: ctx.Err()}
+}
+
+func TestRunCancelCause(t *testing.T) {
+	s, err := notify.NewService(blockClient{}, time.Minute, 1, zerolog.New(ioutil.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	queue := make(chan message.Message, 1)
+	queue <- message.Message{Body: "foo"}
+	close(queue)
+	out := s.Run(ctx, queue)
+
+	stop := errors.New("stop")
+	cancel(stop)
+	res := <-out
+	if !errors.Is(res.Err, stop) {
+		t.Errorf("want error to wrap the cause %v got %v", stop, res.Err)
+	}
+	if !errors.Is(res.Err, context.Canceled) {
+		t.Errorf("want error to wrap %v got %v", context.Canceled, res.Err)
+	}
+	for range out {
+	}
+}
+
+// gateClient is a mock client which blocks requests until its gate is closed.
+type gateClient struct {
+	sync.Mutex
+	active int // requests in flight
+	gate   chan struct{}
+}
+
+func (gc *gateClient) Post(ctx context.Context, m message.Message) notify.PostResult {
+	gc.Lock()
+	gc.active++
+	gc.Unlock()
+	<-gc.gate
+	gc.Lock()
+	gc.active--
+	gc.Unlock()
+	return notify.PostResult{Msg: m.Body}
+}
+
+func (gc *gateClient) waitActive(t *testing.T, n int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		gc.Lock()
+		active := gc.active
+		gc.Unlock()
+		if active == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("want %d requests in flight", n)
+}
+
+func TestSetConcurrency(t *testing.T) {
+	logger := zerolog.New(ioutil.Discard)
+	client := &gateClient{gate: make(chan struct{})}
+	s, err := notify.NewService(client, time.Second, 1, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.SetConcurrency(0); err == nil {
+		t.Error("expected error for concurrency 0")
+	}
+
+	queue := make(chan message.Message, 4)
+	for _, body := range []string{"foo", "bar", "baz", "qux"} {
+		queue <- message.Message{Body: body}
+	}
+	close(queue)
+	out := s.Run(context.Background(), queue)
+
+	client.waitActive(t, 1)
+	// the limit grows while a request is in flight
+	if err := s.SetConcurrency(3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client.waitActive(t, 3)
+	if want, got := 3, s.InFlight(); want != got {
+		t.Errorf("want %d requests in flight got %d", want, got)
+	}
+	if want, got := 3, s.Concurrency(); want != got {
+		t.Errorf("want concurrency %d got %d", want, got)
+	}
+	// the limit shrinks without canceling requests in flight
+	if err := s.SetConcurrency(1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	close(client.gate)
+
+	// the outbound channel is closed after all requests have returned
+	var n int
+	for range out {
+		n++
+	}
+	if want, got := 4, n; want != got {
+		t.Errorf("want %d results got %d", want, got)
+	}
+}
+
 // test for leaking goroutines
 func TestMain(m *testing.M) {
 	goleak.VerifyTestMain(m)
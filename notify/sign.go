@@ -0,0 +1,187 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signature formats supported by the Signer.
+const (
+	// FormatStripe puts timestamp and signature into a single header:
+	// "t=<unix timestamp>,v1=<signature>".
+	FormatStripe = "stripe"
+	// FormatGitHub puts the signature of the body into the signature header
+	// as "sha256=<signature>". No timestamp is sent.
+	FormatGitHub = "github"
+)
+
+// signature encodings supported by the Signer.
+const (
+	EncodingHex    = "hex"
+	EncodingBase64 = "base64"
+)
+
+const DefaultSignatureHeader = "X-Signature"
+
+var (
+	ErrMissingSignature = errors.New("missing signature")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpiredSignature = errors.New("signature timestamp outside of tolerance")
+)
+
+// Signer signs requests with a HMAC-SHA256 signature. With FormatStripe, the
+// signed payload is the unix timestamp and the request body, separated by a
+// dot. Including the timestamp allows receivers to reject replayed requests.
+// With FormatGitHub, the signed payload is the request body only, so
+// receivers cannot detect replayed requests.
+type Signer struct {
+	secret   []byte
+	header   string
+	format   string
+	encoding string
+	now      func() time.Time
+}
+
+// NewSigner returns a reference to a Signer. Empty header, format and
+// encoding arguments are replaced by defaults.
+func NewSigner(secret []byte, header, format, encoding string) (*Signer, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("signing secret must not be empty")
+	}
+	if header == "" {
+		header = DefaultSignatureHeader
+	}
+	if format == "" {
+		format = FormatStripe
+	}
+	if format != FormatStripe && format != FormatGitHub {
+		return nil, fmt.Errorf("unsupported signature format: %s", format)
+	}
+	if encoding == "" {
+		encoding = EncodingHex
+	}
+	if encoding != EncodingHex && encoding != EncodingBase64 {
+		return nil, fmt.Errorf("unsupported signature encoding: %s", encoding)
+	}
+	return &Signer{
+		secret:   secret,
+		header:   header,
+		format:   format,
+		encoding: encoding,
+		now:      time.Now,
+	}, nil
+}
+
+// Sign sets the signature headers of the request for the given body.
+func (s *Signer) Sign(req *http.Request, body []byte) {
+	if s.format == FormatGitHub {
+		req.Header.Set(s.header, "sha256="+s.sign(body))
+		return
+	}
+	ts := strconv.FormatInt(s.now().Unix(), 10)
+	req.Header.Set(s.header, fmt.Sprintf("t=%s,v1=%s", ts, s.sign([]byte(ts), []byte("."), body)))
+}
+
+// Verify checks the signature headers against the body. Signatures with a
+// timestamp older or newer than tolerance are rejected. A tolerance of zero
+// disables the check. With FormatGitHub, there is no timestamp, so tolerance
+// does not apply. Receivers can use this to verify signed requests.
+func (s *Signer) Verify(h http.Header, body []byte, tolerance time.Duration) error {
+	var ts, sig string
+	switch s.format {
+	case FormatGitHub:
+		sig = strings.TrimPrefix(h.Get(s.header), "sha256=")
+		if sig == "" {
+			return ErrMissingSignature
+		}
+		if !hmac.Equal([]byte(sig), []byte(s.sign(body))) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		for _, part := range strings.Split(h.Get(s.header), ",") {
+			kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "t":
+				ts = kv[1]
+			case "v1":
+				sig = kv[1]
+			}
+		}
+	}
+	if ts == "" || sig == "" {
+		return ErrMissingSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.sign([]byte(ts), []byte("."), body))) {
+		return ErrInvalidSignature
+	}
+	return s.checkTimestamp(ts, tolerance)
+}
+
+// checkTimestamp rejects timestamps older or newer than tolerance.
+func (s *Signer) checkTimestamp(ts string, tolerance time.Duration) error {
+	if tolerance <= 0 {
+		return nil
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	d := s.now().Sub(time.Unix(unix, 0))
+	if d > tolerance || d < -tolerance {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+// sign returns the encoded signature of the concatenated parts.
+func (s *Signer) sign(parts ...[]byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	if s.encoding == EncodingBase64 {
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ReadSecret reads a secret from a file or, if file is empty, from the
+// environment variable env. Surrounding whitespace is trimmed.
+func ReadSecret(file, env string) ([]byte, error) {
+	var s string
+	switch {
+	case file != "":
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		s = string(b)
+	case env != "":
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s not set", env)
+		}
+		s = v
+	default:
+		return nil, errors.New("no secret file or environment variable specified")
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("secret is empty")
+	}
+	return []byte(s), nil
+}
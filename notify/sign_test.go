@@ -0,0 +1,146 @@
+package notify_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+var signTests = []struct {
+	d string // description of test case
+	f string // signature format
+	e string // signature encoding
+}{
+	{
+		d: "expect stripe formatted hex signature to verify",
+		f: notify.FormatStripe,
+		e: notify.EncodingHex,
+	},
+	{
+		d: "expect github formatted base64 signature to verify",
+		f: notify.FormatGitHub,
+		e: notify.EncodingBase64,
+	},
+}
+
+func TestSign(t *testing.T) {
+	for _, tc := range signTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			signer, err := notify.NewSigner([]byte("secret"), "", tt.f, tt.e)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// the receiver verifies the signature of the request, errors are
+			// checked on the test goroutine
+			var tampered error
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if err := signer.Verify(r.Header, body, time.Minute); err != nil {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				// a tampered body must not verify
+				tampered = signer.Verify(r.Header, append(body, '!'), time.Minute)
+			}))
+			defer srv.Close()
+
+			c := notify.NewHttpClient(srv.URL, notify.WithSigner(signer))
+			res := c.Post(context.Background(), message.Message{Body: "foo"})
+			if res.Err != nil {
+				t.Errorf("unexpected err: %v", res.Err)
+			}
+			if want, got := notify.ErrInvalidSignature, tampered; want != got {
+				t.Errorf("want err %v got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestSignGitHub(t *testing.T) {
+	signer, err := notify.NewSigner([]byte("secret"), "X-Hub-Signature-256", notify.FormatGitHub, notify.EncodingHex)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	signer.Sign(req, []byte("foo"))
+
+	// the signature covers the body only
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("foo"))
+	if want, got := "sha256="+hex.EncodeToString(mac.Sum(nil)), req.Header.Get("X-Hub-Signature-256"); want != got {
+		t.Errorf("want signature %s got %s", want, got)
+	}
+	if want, got := 1, len(req.Header); want != got {
+		t.Errorf("want %d header got %d", want, got)
+	}
+	if err := signer.Verify(req.Header, []byte("foo"), time.Minute); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	signer, err := notify.NewSigner([]byte("secret"), "", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a valid signature created an hour ago
+	ts := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(ts + ".foo"))
+	h := http.Header{}
+	h.Set(notify.DefaultSignatureHeader, fmt.Sprintf("t=%s,v1=%s", ts, hex.EncodeToString(mac.Sum(nil))))
+
+	if err := signer.Verify(h, []byte("foo"), 0); err != nil {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if err := signer.Verify(h, []byte("foo"), time.Minute); err != notify.ErrExpiredSignature {
+		t.Errorf("want err %v got %v", notify.ErrExpiredSignature, err)
+	}
+	if err := signer.Verify(http.Header{}, []byte("foo"), 0); err != notify.ErrMissingSignature {
+		t.Errorf("want err %v got %v", notify.ErrMissingSignature, err)
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(file, []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("NOTIFY_TEST_SECRET", "bar")
+	defer os.Unsetenv("NOTIFY_TEST_SECRET")
+
+	s, err := notify.ReadSecret(file, "NOTIFY_TEST_SECRET")
+	if err != nil || string(s) != "foo" {
+		t.Errorf("want secret foo from file got %q, %v", s, err)
+	}
+	s, err = notify.ReadSecret("", "NOTIFY_TEST_SECRET")
+	if err != nil || string(s) != "bar" {
+		t.Errorf("want secret bar from env got %q, %v", s, err)
+	}
+	if _, err := notify.ReadSecret("", ""); err == nil {
+		t.Error("expect error when no source is specified")
+	}
+}
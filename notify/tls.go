@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// TLSOptions describe the TLS configuration of a HttpClient.
+type TLSOptions struct {
+	CAFile     string   // PEM encoded CA bundle used to verify receivers
+	CertFile   string   // PEM encoded client certificate
+	KeyFile    string   // PEM encoded client key
+	MinVersion string   // minimum TLS version [1.0|1.1|1.2|1.3]
+	ServerName string   // overrides the server name used for verification
+	Pins       []string // base64 encoded SHA-256 hashes of pinned public keys (SPKI)
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ErrPinMismatch is returned if no certificate of the receiver's
+// chain matches one of the pinned public keys.
+var ErrPinMismatch = errors.New("no pinned public key found in certificate chain")
+
+// Config reads the certificates from disk and returns a tls.Config. It is
+// called again on reload to pick up rotated certificates.
+func (o TLSOptions) Config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: o.ServerName,
+	}
+	if o.MinVersion != "" {
+		v, ok := tlsVersions[o.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version: %s", o.MinVersion)
+		}
+		cfg.MinVersion = v
+	}
+	if o.CAFile != "" {
+		pem, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if len(o.Pins) > 0 {
+		pins := make(map[string]bool, len(o.Pins))
+		for _, p := range o.Pins {
+			pins[strings.TrimPrefix(strings.TrimSpace(p), "sha256/")] = true
+		}
+		// the chains have been verified already, so we only need to check
+		// if one of the certificates contains a pinned public key
+		cfg.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+			for _, chain := range chains {
+				for _, cert := range chain {
+					sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+					if pins[base64.StdEncoding.EncodeToString(sum[:])] {
+						return nil
+					}
+				}
+			}
+			return ErrPinMismatch
+		}
+	}
+	return cfg, nil
+}
+
+// WithTLSConfig uses the provided TLS configuration for connections to the
+// receiver.
+func WithTLSConfig(cfg *tls.Config) ClientOption {
+	return func(c *HttpClient) {
+		c.tlsConfig = cfg
+	}
+}
+
+// SetTLSConfig replaces the TLS configuration of the HttpClient. New requests
+// use the new configuration, in-flight requests are not affected. Idle
+// connections established with the old configuration are closed.
+func (c *HttpClient) SetTLSConfig(cfg *tls.Config) error {
+	if c.transport == nil {
+		return errors.New("client does not support TLS reloading")
+	}
+	c.transport.set(newTransport(cfg))
+	return nil
+}
+
+// swapTransport delegates requests to a Transport which can be replaced
+// while requests are in flight.
+type swapTransport struct {
+	sync.RWMutex
+	t *http.Transport
+}
+
+func (st *swapTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	st.RLock()
+	t := st.t
+	st.RUnlock()
+	return t.RoundTrip(req)
+}
+
+func (st *swapTransport) set(t *http.Transport) {
+	st.Lock()
+	old := st.t
+	st.t = t
+	st.Unlock()
+	old.CloseIdleConnections()
+}
@@ -0,0 +1,169 @@
+package notify_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+// writePEM writes a PEM block to a file in dir and returns its path.
+func writePEM(t *testing.T, dir, name, typ string, b []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeClientCert creates a self-signed client certificate and key.
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "notify"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert,
+		writePEM(t, dir, "client.crt", "CERTIFICATE", der),
+		writePEM(t, dir, "client.key", "EC PRIVATE KEY", keyDER)
+}
+
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientCert, certFile, keyFile := writeClientCert(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	// the receiver requires a client certificate
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := writePEM(t, dir, "ca.crt", "CERTIFICATE", srv.Certificate().Raw)
+	sum := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+
+	var tlsTests = []struct {
+		d string            // description of test case
+		o notify.TLSOptions // client TLS options
+		e bool              // expect error
+	}{
+		{
+			d: "expect error without client certificate",
+			o: notify.TLSOptions{CAFile: caFile},
+			e: true,
+		},
+		{
+			d: "expect error with unknown CA",
+			o: notify.TLSOptions{CertFile: certFile, KeyFile: keyFile},
+			e: true,
+		},
+		{
+			d: "expect success with CA and client certificate",
+			o: notify.TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile},
+		},
+		{
+			d: "expect success with server name override",
+			o: notify.TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "example.com"},
+		},
+		{
+			d: "expect success with matching pin",
+			o: notify.TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, Pins: []string{"sha256/" + pin}},
+		},
+		{
+			d: "expect error with pin mismatch",
+			o: notify.TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, Pins: []string{"Zm9v"}},
+			e: true,
+		},
+	}
+	for _, tc := range tlsTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			cfg, err := tt.o.Config()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			c := notify.NewHttpClient(srv.URL, notify.WithTLSConfig(cfg))
+			res := c.Post(context.Background(), message.Message{Body: "foo"})
+			if res.Err != nil && !tt.e {
+				t.Errorf("unexpected err: %v", res.Err)
+			}
+			if res.Err == nil && tt.e {
+				t.Error("expected err")
+			}
+		})
+	}
+
+	// certificates are picked up after a reload
+	cfg, err := notify.TLSOptions{CAFile: caFile}.Config()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := notify.NewHttpClient(srv.URL, notify.WithTLSConfig(cfg))
+	if res := c.Post(context.Background(), message.Message{Body: "foo"}); res.Err == nil {
+		t.Fatal("expected err without client certificate")
+	}
+	cfg, err = notify.TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}.Config()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.SetTLSConfig(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res := c.Post(context.Background(), message.Message{Body: "foo"}); res.Err != nil {
+		t.Errorf("unexpected err after reload: %v", res.Err)
+	}
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	if _, err := (notify.TLSOptions{MinVersion: "1.3"}).Config(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := (notify.TLSOptions{MinVersion: "2.0"}).Config(); err == nil {
+		t.Error("expect error for unsupported TLS version")
+	}
+}
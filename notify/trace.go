@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing is the latency breakdown of a request in milliseconds. DNS, Connect
+// and TLS are zero if a kept-alive connection was reused. TTFB is measured
+// from the start of the last attempt, Total from the start of the first one
+// until the response body has been read.
+type Timing struct {
+	DNS     float64 `json:"dns_ms"`
+	Connect float64 `json:"connect_ms"`
+	TLS     float64 `json:"tls_ms"`
+	TTFB    float64 `json:"ttfb_ms"`
+	Total   float64 `json:"total_ms"`
+}
+
+// tracer records the timing of a single request attempt. Hooks of a
+// ClientTrace may be called from different goroutines, so access is guarded.
+type tracer struct {
+	sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	timing       Timing
+}
+
+func newTracer() *tracer {
+	return &tracer{start: time.Now()}
+}
+
+// context returns a Context which reports to the tracer.
+func (t *tracer) context(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.Lock()
+			t.dnsStart = time.Now()
+			t.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.Lock()
+			t.timing.DNS = ms(time.Since(t.dnsStart))
+			t.Unlock()
+		},
+		ConnectStart: func(_, _ string) {
+			t.Lock()
+			t.connectStart = time.Now()
+			t.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err != nil {
+				return
+			}
+			t.Lock()
+			t.timing.Connect = ms(time.Since(t.connectStart))
+			t.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.Lock()
+			t.tlsStart = time.Now()
+			t.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.Lock()
+			t.timing.TLS = ms(time.Since(t.tlsStart))
+			t.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.Lock()
+			t.timing.TTFB = ms(time.Since(t.start))
+			t.Unlock()
+		},
+	})
+}
+
+func (t *tracer) result() Timing {
+	t.Lock()
+	defer t.Unlock()
+	return t.timing
+}
+
+// ms converts a duration to milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,65 @@
+package notify_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+func TestPostResultMetadata(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "abc")
+		w.Header().Set("X-Other", "other")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	c := notify.NewHttpClient(srv.URL, notify.WithResultHeaders("X-Request-Id", "X-Missing"))
+	// we use the test server's transport which trusts its certificate
+	cfg := srv.Client().Transport.(*http.Transport).TLSClientConfig
+	if err := c.SetTLSConfig(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res := c.Post(context.Background(), message.Message{ID: "1", Body: "foo"})
+	if res.Err != nil {
+		t.Fatalf("unexpected err: %v", res.Err)
+	}
+	if want, got := "1", res.ID; want != got {
+		t.Errorf("want id %q got %q", want, got)
+	}
+	if want, got := srv.URL, res.URL; want != got {
+		t.Errorf("want url %q got %q", want, got)
+	}
+	if want, got := http.StatusAccepted, res.StatusCode; want != got {
+		t.Errorf("want status code %d got %d", want, got)
+	}
+	if want, got := 1, res.Attempts; want != got {
+		t.Errorf("want %d attempts got %d", want, got)
+	}
+	if want, got := map[string]string{"X-Request-Id": "abc"}, res.Headers; !reflect.DeepEqual(want, got) {
+		t.Errorf("want headers %v got %v", want, got)
+	}
+	if res.Start.IsZero() {
+		t.Error("expect start time to be set")
+	}
+	// a new connection is established for the first request
+	tm := res.Timing
+	if tm.Connect <= 0 || tm.TLS <= 0 || tm.TTFB <= 0 || tm.Total < tm.TTFB {
+		t.Errorf("expect connect, TLS, TTFB and total latency to be recorded, got %+v", tm)
+	}
+
+	// the connection is reused for the second request
+	res = c.Post(context.Background(), message.Message{ID: "2", Body: "foo"})
+	if res.Err != nil {
+		t.Fatalf("unexpected err: %v", res.Err)
+	}
+	if tm := res.Timing; tm.Connect != 0 || tm.TLS != 0 || tm.TTFB <= 0 {
+		t.Errorf("expect only TTFB for a reused connection, got %+v", tm)
+	}
+}
@@ -1,13 +1,21 @@
 package notify
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
 )
 
+// PostErr is the error of a failed Post request.
 type PostErr struct {
-	Err      string         `json:"error"`
-	Response *http.Response `json:"-"` // will not be marshalled
+	Err       string         `json:"message"`
+	Class     string         `json:"class"`
+	Retryable bool           `json:"retryable"`
+	Response  *http.Response `json:"-"` // will not be marshalled
+	cause     error
 }
 
 func (e PostErr) Error() string {
@@ -20,9 +28,46 @@ func (e PostErr) Error() string {
 		e.Err)
 }
 
+// Unwrap returns the error which caused the PostErr.
+func (e PostErr) Unwrap() error {
+	return e.cause
+}
+
 // PostResult represents the result of a Post request.
 type PostResult struct {
-	Msg  string `json:"message"`
-	Body string `json:"response_body"`
-	Err  error  `json:"error"`
+	ID         string            `json:"id"`
+	Msg        string            `json:"message"`
+	MsgHeaders map[string]string `json:"message_headers,omitempty"`
+	URL        string            `json:"url"`
+	StatusCode int               `json:"status_code,omitempty"`
+	Headers    map[string]string `json:"response_headers,omitempty"`
+	Attempts   int               `json:"attempts"`
+	Start      time.Time         `json:"start"`
+	Timing     Timing            `json:"timing"`
+	Body       string            `json:"response_body"`
+	Truncated  bool              `json:"response_body_truncated,omitempty"`
+	BodyFile   string            `json:"response_body_file,omitempty"`
+	Duplicate  bool              `json:"duplicate,omitempty"` // the message was dropped as a duplicate and not sent
+	Err        error             `json:"error"`
+
+	Pos message.Position `json:"-"` // position of the message in the input
+}
+
+// MarshalJSON encodes the result. Errors are encoded as ErrorInfo, so the
+// cause of an error is preserved, no matter where it originated.
+func (r PostResult) MarshalJSON() ([]byte, error) {
+	// the alias type has no methods, which prevents infinite recursion
+	type result PostResult
+	var info *ErrorInfo
+	if r.Err != nil {
+		i := Classify(r.Err)
+		info = &i
+	}
+	return json.Marshal(struct {
+		result
+		Err *ErrorInfo `json:"error"`
+	}{
+		result: result(r),
+		Err:    info,
+	})
 }
@@ -0,0 +1,266 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Validator decides if a response is considered successful.
+type Validator struct {
+	statuses []statusRange  // accepted status codes
+	bodyRe   *regexp.Regexp // the response body must match
+	jsonPath *jsonAssertion // the response body must satisfy
+	headers  []string       // the response must contain
+}
+
+// ValidatorOptions describe the success criteria of a Validator.
+type ValidatorOptions struct {
+	// Statuses is a comma separated list of accepted status codes or ranges,
+	// e.g. "200,202-204". Defaults to "200-299".
+	Statuses string
+	// BodyRegex is a regular expression the response body must match.
+	BodyRegex string
+	// JSONPath is an assertion on the JSON response body, e.g. `$.ok == true`,
+	// `$.items[0].id != null` or `$.ok` to require a field which is neither
+	// false nor null. Supported operators are == and !=. Missing fields are
+	// treated like null.
+	JSONPath string
+	// Headers lists the names of headers the response must contain.
+	Headers []string
+}
+
+type statusRange struct {
+	from, to int
+}
+
+// NewValidator returns a reference to a Validator.
+func NewValidator(o ValidatorOptions) (*Validator, error) {
+	v := &Validator{
+		statuses: []statusRange{{200, 299}},
+		headers:  o.Headers,
+	}
+	if o.Statuses != "" {
+		statuses, err := parseStatuses(o.Statuses)
+		if err != nil {
+			return nil, err
+		}
+		v.statuses = statuses
+	}
+	if o.BodyRegex != "" {
+		re, err := regexp.Compile(o.BodyRegex)
+		if err != nil {
+			return nil, err
+		}
+		v.bodyRe = re
+	}
+	if o.JSONPath != "" {
+		a, err := parseJSONAssertion(o.JSONPath)
+		if err != nil {
+			return nil, err
+		}
+		v.jsonPath = a
+	}
+	return v, nil
+}
+
+// WithValidator uses the provided Validator to decide if a response is
+// successful. Without it, status codes between 200-299 are successful.
+func WithValidator(v *Validator) ClientOption {
+	return func(c *HttpClient) {
+		c.validator = v
+	}
+}
+
+// defaultValidator accepts all responses with a status code between 200-299.
+var defaultValidator = &Validator{
+	statuses: []statusRange{{200, 299}},
+}
+
+// Validate returns an error describing the first criterion the response does
+// not meet. If the status code is not accepted, the error is the body.
+func (v *Validator) Validate(resp *http.Response, body []byte) error {
+	if !v.accepts(resp.StatusCode) {
+		return statusError{code: resp.StatusCode, body: body}
+	}
+	for _, h := range v.headers {
+		if resp.Header.Get(h) == "" {
+			return validationError{fmt.Sprintf("missing response header: %s", h)}
+		}
+	}
+	if v.bodyRe != nil && !v.bodyRe.Match(body) {
+		return validationError{fmt.Sprintf("response body does not match: %s", v.bodyRe)}
+	}
+	if v.jsonPath != nil {
+		if err := v.jsonPath.check(body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodes reports whether the Validator checks the content of the body.
+func (v *Validator) decodes() bool {
+	return v.bodyRe != nil || v.jsonPath != nil
+}
+
+func (v *Validator) accepts(status int) bool {
+	for _, r := range v.statuses {
+		if status >= r.from && status <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+func parseStatuses(s string) ([]statusRange, error) {
+	var ranges []statusRange
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code: %s", part)
+		}
+		to := from
+		if len(bounds) == 2 {
+			to, err = strconv.Atoi(bounds[1])
+			if err != nil || to < from {
+				return nil, fmt.Errorf("invalid status code range: %s", part)
+			}
+		}
+		ranges = append(ranges, statusRange{from, to})
+	}
+	return ranges, nil
+}
+
+// jsonAssertion compares the value at a path of a JSON document.
+type jsonAssertion struct {
+	expr  string
+	path  []interface{} // object keys (string) and array indices (int)
+	op    string        // "==", "!=" or "" for a truthy value
+	value interface{}
+}
+
+var pathSegment = regexp.MustCompile(`^(?:\.([A-Za-z0-9_\-]+)|\[(\d+)\]|\["([^"]*)"\])`)
+
+// parseJSONAssertion parses an assertion like $.ok == true. The path is
+// parsed first, so operators within the value do not split the expression.
+func parseJSONAssertion(expr string) (*jsonAssertion, error) {
+	a := &jsonAssertion{expr: expr}
+	var (
+		rest string
+		err  error
+	)
+	if a.path, rest, err = parseJSONPathPrefix(strings.TrimSpace(expr)); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, expr)
+	}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return a, nil
+	}
+	for _, op := range []string{"==", "!="} {
+		if strings.HasPrefix(rest, op) {
+			a.op = op
+			if err := json.Unmarshal([]byte(strings.TrimSpace(rest[len(op):])), &a.value); err != nil {
+				return nil, fmt.Errorf("invalid JSONPath value: %s", expr)
+			}
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid JSONPath operator: %s", expr)
+}
+
+func (a *jsonAssertion) check(body []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return validationError{fmt.Sprintf("response body is not JSON: %v", err)}
+	}
+	v, found := lookupJSONPath(doc, a.path)
+
+	// missing values are treated like null
+	if !found {
+		v = nil
+	}
+	var ok bool
+	switch a.op {
+	case "==":
+		ok = reflect.DeepEqual(v, a.value)
+	case "!=":
+		ok = !reflect.DeepEqual(v, a.value)
+	default:
+		ok = v != nil && v != false
+	}
+	if !ok {
+		return validationError{fmt.Sprintf("response body does not satisfy: %s", a.expr)}
+	}
+	return nil
+}
+
+// parseJSONPath parses a path like $.items[0].id into object keys (string)
+// and array indices (int).
+func parseJSONPath(path string) ([]interface{}, error) {
+	segs, rest, err := parseJSONPathPrefix(path)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid JSONPath")
+	}
+	return segs, nil
+}
+
+// parseJSONPathPrefix parses the path at the start of s and returns the rest
+// of s after it.
+func parseJSONPathPrefix(s string) ([]interface{}, string, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, "", fmt.Errorf("JSONPath must start with $")
+	}
+	var segs []interface{}
+	path := s[1:]
+	for path != "" {
+		m := pathSegment.FindStringSubmatch(path)
+		if m == nil {
+			break
+		}
+		switch {
+		case m[1] != "":
+			segs = append(segs, m[1])
+		case m[2] != "":
+			i, _ := strconv.Atoi(m[2])
+			segs = append(segs, i)
+		default:
+			segs = append(segs, m[3])
+		}
+		path = path[len(m[0]):]
+	}
+	return segs, path, nil
+}
+
+// lookupJSONPath returns the value at path of the decoded JSON document and
+// whether it was found.
+func lookupJSONPath(doc interface{}, path []interface{}) (interface{}, bool) {
+	v := doc
+	for _, seg := range path {
+		switch s := seg.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = obj[s]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := v.([]interface{})
+			if !ok || s >= len(arr) {
+				return nil, false
+			}
+			v = arr[s]
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,167 @@
+package notify_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fgrimme/refurbed/notify"
+)
+
+var validateTests = []struct {
+	d string                  // description of test case
+	o notify.ValidatorOptions // success criteria
+	s int                     // status code of the response
+	h http.Header             // response headers
+	b string                  // response body
+	e bool                    // expect error
+}{
+	{
+		d: "expect 2xx to be accepted by default",
+		s: http.StatusAccepted,
+	},
+	{
+		d: "expect 3xx to be rejected by default",
+		s: http.StatusFound,
+		e: true,
+	},
+	{
+		d: "expect status code in range to be accepted",
+		o: notify.ValidatorOptions{Statuses: "200,300-399"},
+		s: http.StatusFound,
+	},
+	{
+		d: "expect status code outside of set to be rejected",
+		o: notify.ValidatorOptions{Statuses: "200,204"},
+		s: http.StatusCreated,
+		e: true,
+	},
+	{
+		d: "expect body matching regex to be accepted",
+		o: notify.ValidatorOptions{BodyRegex: `^ok`},
+		s: http.StatusOK,
+		b: "ok",
+	},
+	{
+		d: "expect body not matching regex to be rejected",
+		o: notify.ValidatorOptions{BodyRegex: `^ok`},
+		s: http.StatusOK,
+		b: "error: not ok",
+		e: true,
+	},
+	{
+		d: "expect JSONPath equality to be accepted",
+		o: notify.ValidatorOptions{JSONPath: `$.ok == true`},
+		s: http.StatusOK,
+		b: `{"ok": true}`,
+	},
+	{
+		d: "expect error payload to be rejected",
+		o: notify.ValidatorOptions{JSONPath: `$.ok == true`},
+		s: http.StatusOK,
+		b: `{"ok": false, "error": "invalid message"}`,
+		e: true,
+	},
+	{
+		d: "expect nested JSONPath to be accepted",
+		o: notify.ValidatorOptions{JSONPath: `$.items[1]["id"] == "b"`},
+		s: http.StatusOK,
+		b: `{"items": [{"id": "a"}, {"id": "b"}]}`,
+	},
+	{
+		d: "expect value containing == to be compared",
+		o: notify.ValidatorOptions{JSONPath: `$.state != "a==b"`},
+		s: http.StatusOK,
+		b: `{"state": "ok"}`,
+	},
+	{
+		d: "expect value containing != to be compared",
+		o: notify.ValidatorOptions{JSONPath: `$.state == "a!=b"`},
+		s: http.StatusOK,
+		b: `{"state": "a!=b"}`,
+	},
+	{
+		d: "expect operator without spaces to be parsed",
+		o: notify.ValidatorOptions{JSONPath: `$.x!=1`},
+		s: http.StatusOK,
+		b: `{"x": 1}`,
+		e: true,
+	},
+	{
+		d: "expect quoted key containing an operator to be looked up",
+		o: notify.ValidatorOptions{JSONPath: `$["a==b"] == 1`},
+		s: http.StatusOK,
+		b: `{"a==b": 1}`,
+	},
+	{
+		d: "expect missing field to be treated like null",
+		o: notify.ValidatorOptions{JSONPath: `$.error == null`},
+		s: http.StatusOK,
+		b: `{}`,
+	},
+	{
+		d: "expect missing field to be rejected as truthy value",
+		o: notify.ValidatorOptions{JSONPath: `$.ok`},
+		s: http.StatusOK,
+		b: `{}`,
+		e: true,
+	},
+	{
+		d: "expect non JSON body to be rejected",
+		o: notify.ValidatorOptions{JSONPath: `$.ok`},
+		s: http.StatusOK,
+		b: `ok`,
+		e: true,
+	},
+	{
+		d: "expect required header to be accepted",
+		o: notify.ValidatorOptions{Headers: []string{"X-Request-Id"}},
+		s: http.StatusOK,
+		h: http.Header{"X-Request-Id": {"1"}},
+	},
+	{
+		d: "expect missing header to be rejected",
+		o: notify.ValidatorOptions{Headers: []string{"X-Request-Id"}},
+		s: http.StatusOK,
+		e: true,
+	},
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range validateTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			v, err := notify.NewValidator(tt.o)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp := &http.Response{StatusCode: tt.s, Header: tt.h}
+			if resp.Header == nil {
+				resp.Header = http.Header{}
+			}
+			err = v.Validate(resp, []byte(tt.b))
+			if err != nil && !tt.e {
+				t.Errorf("unexpected err: %v", err)
+			}
+			if err == nil && tt.e {
+				t.Error("expected err")
+			}
+		})
+	}
+}
+
+func TestNewValidator(t *testing.T) {
+	for _, o := range []notify.ValidatorOptions{
+		{Statuses: "2xx"},
+		{Statuses: "299-200"},
+		{BodyRegex: "("},
+		{JSONPath: "ok == true"},
+		{JSONPath: "$.ok == yes"},
+		{JSONPath: "$..ok"},
+		{JSONPath: "$.ok = true"},
+		{JSONPath: "$.ok true"},
+	} {
+		if _, err := notify.NewValidator(o); err == nil {
+			t.Errorf("expect error for invalid options %+v", o)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+)
+
+// DeadLetter is the record of a message which could not be delivered. The
+// embedded Message is encoded as is, so dead-letter files can be read back
+// as JSON Lines input.
+type DeadLetter struct {
+	message.Message
+	StatusCode int               `json:"status_code,omitempty"` // of the last attempt
+	Error      *notify.ErrorInfo `json:"error"`
+	Attempts   int               `json:"attempts"`
+	Start      time.Time         `json:"start"`
+	FailedAt   time.Time         `json:"failed_at"`
+}
+
+// NewDeadLetter returns the DeadLetter of a failed result.
+func NewDeadLetter(res notify.PostResult) DeadLetter {
+	info := notify.Classify(res.Err)
+	return DeadLetter{
+		Message: message.Message{
+			ID:      res.ID,
+			Body:    res.Msg,
+			Headers: res.MsgHeaders,
+		},
+		StatusCode: res.StatusCode,
+		Error:      &info,
+		Attempts:   res.Attempts,
+		Start:      res.Start,
+		FailedAt:   res.Start.Add(time.Duration(res.Timing.Total * float64(time.Millisecond))),
+	}
+}
+
+type deadLetterWriter struct {
+	enc *json.Encoder
+}
+
+// NewDeadLetterWriter returns a Writer which writes a DeadLetter per failed
+// result to w, one per line. Successful results are dropped.
+func NewDeadLetterWriter(w io.Writer) Writer {
+	return &deadLetterWriter{enc: json.NewEncoder(w)}
+}
+
+func (d *deadLetterWriter) Write(res notify.PostResult) error {
+	if res.Err == nil {
+		return nil
+	}
+	return d.enc.Encode(NewDeadLetter(res))
+}
@@ -0,0 +1,72 @@
+package output_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/fgrimme/refurbed/output"
+	"github.com/fgrimme/refurbed/scan"
+	"github.com/rs/zerolog"
+)
+
+func TestDeadLetterWriter(t *testing.T) {
+	failed := notify.PostResult{
+		ID:         "2",
+		Msg:        "bar",
+		MsgHeaders: map[string]string{"X-Foo": "bar"},
+		StatusCode: 503,
+		Attempts:   3,
+		Start:      time.Date(2019, 10, 16, 10, 0, 0, 0, time.UTC),
+		Err:        context.DeadlineExceeded,
+	}
+	var buf bytes.Buffer
+	w := output.NewDeadLetterWriter(&buf)
+	for _, res := range []notify.PostResult{results[0], failed} {
+		if err := w.Write(res); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if want, got := 1, len(lines); want != got {
+		t.Fatalf("want %d lines got %d:\n%s", want, got, buf.String())
+	}
+
+	var dl output.DeadLetter
+	if err := json.Unmarshal([]byte(lines[0]), &dl); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want, got := notify.ErrClassTimeout, dl.Error.Class; want != got {
+		t.Errorf("want error class %q got %q", want, got)
+	}
+	if want, got := 3, dl.Attempts; want != got {
+		t.Errorf("want %d attempts got %d", want, got)
+	}
+	// replay filters by status code and start time
+	if want, got := 503, dl.StatusCode; want != got {
+		t.Errorf("want status code %d got %d", want, got)
+	}
+	if want, got := failed.Start, dl.Start; !want.Equal(got) {
+		t.Errorf("want start %v got %v", want, got)
+	}
+
+	// dead letters are valid JSON Lines input
+	s := scan.NewJSONScanner(&buf, zerolog.New(ioutil.Discard))
+	q, errc := s.Run()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := message.Message{ID: "2", Body: "bar", Headers: map[string]string{"X-Foo": "bar"}}
+	got := q.Pop()
+	got.Pos = message.Position{} // the position in the dead-letter file is not of interest
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want message %+v got %+v", want, got)
+	}
+}
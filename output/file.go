@@ -0,0 +1,115 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile is a file which is rotated when it exceeds a max size. Rotated
+// files are renamed to path.1, path.2 and so on, where path.1 is the most
+// recent one. Files exceeding the number of backups are removed.
+type RotatingFile struct {
+	sync.Mutex
+	path    string
+	maxSize int64 // 0 means no rotation
+	backups int
+	header  []byte // written at the start of each file
+	file    *os.File
+	size    int64
+}
+
+// OpenRotatingFile opens or creates the file at path for appending.
+func OpenRotatingFile(path string, maxSize int64, backups int) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:    path,
+		maxSize: maxSize,
+		backups: backups,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetHeader sets a header which is written at the start of each file. If the
+// current file is empty, the header is written immediately.
+func (f *RotatingFile) SetHeader(header []byte) error {
+	f.Lock()
+	defer f.Unlock()
+	f.header = header
+	if f.size > 0 {
+		return nil
+	}
+	return f.writeHeader()
+}
+
+// Write writes p to the file. If the file would exceed the max size, it is
+// rotated before. A single write is never split across files.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.maxSize > 0 && f.size > int64(len(f.header)) && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (f *RotatingFile) Close() error {
+	f.Lock()
+	defer f.Unlock()
+	return f.file.Close()
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if f.backups < 1 {
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+	}
+	for i := f.backups; i > 0; i-- {
+		src := f.path
+		if i > 1 {
+			src = fmt.Sprintf("%s.%d", f.path, i-1)
+		}
+		err := os.Rename(src, fmt.Sprintf("%s.%d", f.path, i))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.writeHeader()
+}
+
+func (f *RotatingFile) writeHeader() error {
+	if len(f.header) == 0 {
+		return nil
+	}
+	n, err := f.file.Write(f.header)
+	f.size += int64(n)
+	return err
+}
@@ -0,0 +1,53 @@
+package output_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fgrimme/refurbed/output"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "results")
+	f, err := output.OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := f.SetHeader([]byte("h\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, line := range []string{"foo 1\n", "foo 2\n", "foo 3\n", "foo 4\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the oldest file exceeds the number of backups and is removed
+	for file, want := range map[string]string{
+		path:        "h\nfoo 4\n",
+		path + ".1": "h\nfoo 3\n",
+		path + ".2": "h\nfoo 2\n",
+	} {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := string(b); want != got {
+			t.Errorf("want %s to contain %q got %q", file, want, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("expect no more than 2 backups")
+	}
+}
@@ -0,0 +1,147 @@
+package output
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fgrimme/refurbed/notify"
+)
+
+// resultOverhead is the estimated memory of a buffered result besides its
+// strings and headers.
+const resultOverhead = 256
+
+// Ordered is a Writer which writes results to W in input order, i.e. in order
+// of their sequence numbers. Results which complete early are buffered until
+// all results before them are written.
+//
+// The buffer is bounded: if the buffered results exceed maxBytes, or the
+// buffer has been blocked by a missing result for longer than maxWait, the
+// missing results are skipped and the buffer is written up to the next gap.
+// Skipped results are written as soon as they arrive, out of order. The wait
+// is checked whenever a result is written. Results without a position are
+// written immediately.
+type Ordered struct {
+	sync.Mutex
+	w        Writer
+	maxBytes int64
+	maxWait  time.Duration
+	next     int64 // sequence number of the next result to write
+	pending  map[int64]notify.PostResult
+	size     int64     // estimated memory of the pending results
+	since    time.Time // time the oldest gap started blocking the buffer
+	skipped  int
+}
+
+// NewOrdered returns an Ordered Writer which writes to w. A maxBytes or
+// maxWait of 0 means no limit.
+func NewOrdered(w Writer, maxBytes int64, maxWait time.Duration) *Ordered {
+	return &Ordered{
+		w:        w,
+		maxBytes: maxBytes,
+		maxWait:  maxWait,
+		next:     1,
+		pending:  make(map[int64]notify.PostResult),
+	}
+}
+
+func (o *Ordered) Write(res notify.PostResult) error {
+	o.Lock()
+	defer o.Unlock()
+	// results with an unknown position or which were skipped are written
+	// immediately
+	if res.Pos.Seq == 0 || res.Pos.Seq < o.next {
+		return o.w.Write(res)
+	}
+	if len(o.pending) == 0 {
+		o.since = time.Now()
+	}
+	o.pending[res.Pos.Seq] = res
+	o.size += resultSize(res)
+	if err := o.flush(); err != nil {
+		return err
+	}
+	for len(o.pending) > 0 && o.blocked() {
+		o.skip()
+		if err := o.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes all buffered results in order, skipping missing results. It
+// is called once no more results are expected.
+func (o *Ordered) Flush() error {
+	o.Lock()
+	defer o.Unlock()
+	for len(o.pending) > 0 {
+		o.skip()
+		if err := o.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Skipped returns the number of missing results which were skipped, so their
+// results were not written in order.
+func (o *Ordered) Skipped() int {
+	o.Lock()
+	defer o.Unlock()
+	return o.skipped
+}
+
+// flush writes the pending results up to the next gap.
+func (o *Ordered) flush() error {
+	advanced := false
+	for {
+		res, ok := o.pending[o.next]
+		if !ok {
+			break
+		}
+		delete(o.pending, o.next)
+		o.size -= resultSize(res)
+		o.next++
+		advanced = true
+		if err := o.w.Write(res); err != nil {
+			return err
+		}
+	}
+	if advanced {
+		o.since = time.Now()
+	}
+	return nil
+}
+
+// blocked reports whether the buffer exceeds its limits.
+func (o *Ordered) blocked() bool {
+	if o.maxBytes > 0 && o.size > o.maxBytes {
+		return true
+	}
+	return o.maxWait > 0 && time.Since(o.since) > o.maxWait
+}
+
+// skip advances the next sequence number to the first pending result. The
+// buffer must not be empty.
+func (o *Ordered) skip() {
+	for {
+		if _, ok := o.pending[o.next]; ok {
+			return
+		}
+		o.next++
+		o.skipped++
+	}
+}
+
+// resultSize returns the estimated memory of a result.
+func resultSize(res notify.PostResult) int64 {
+	n := resultOverhead + len(res.ID) + len(res.Msg) + len(res.URL) + len(res.Body) + len(res.BodyFile)
+	for k, v := range res.MsgHeaders {
+		n += len(k) + len(v)
+	}
+	for k, v := range res.Headers {
+		n += len(k) + len(v)
+	}
+	return int64(n)
+}
@@ -0,0 +1,100 @@
+package output_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/fgrimme/refurbed/output"
+)
+
+// recorder is a Writer which records the sequence numbers of the results.
+type recorder []int64
+
+func (r *recorder) Write(res notify.PostResult) error {
+	*r = append(*r, res.Pos.Seq)
+	return nil
+}
+
+// seqResult returns a result of the nth message.
+func seqResult(seq int64) notify.PostResult {
+	return notify.PostResult{Pos: message.Position{Seq: seq}, Msg: strings.Repeat("x", 100)}
+}
+
+var orderedTests = []struct {
+	d string        // description of test case
+	s []int64       // sequence numbers in order of completion
+	m int64         // max bytes
+	w time.Duration // max wait, the result before the last one is delayed by twice the wait
+	o []int64       // expected sequence numbers before flush
+	f []int64       // expected sequence numbers after flush
+	k int           // expected skipped results
+}{
+	{
+		d: "expect results in order",
+		s: []int64{2, 3, 1, 5, 4},
+		o: []int64{1, 2, 3, 4, 5},
+		f: []int64{1, 2, 3, 4, 5},
+	},
+	{
+		d: "expect results to wait for gaps",
+		s: []int64{2, 3, 5},
+		f: []int64{2, 3, 5},
+		k: 2,
+	},
+	{
+		d: "expect results without position to be written immediately",
+		s: []int64{2, 0, 1},
+		o: []int64{0, 1, 2},
+		f: []int64{0, 1, 2},
+	},
+	{
+		d: "expect gap to be skipped if the buffer is full",
+		s: []int64{2, 3, 4, 1},
+		m: 900, // about 2 results
+		o: []int64{2, 3, 4, 1},
+		f: []int64{2, 3, 4, 1},
+		k: 1,
+	},
+	{
+		d: "expect gap to be skipped if the buffer is blocked too long",
+		s: []int64{2, 3, 4, 1},
+		w: 10 * time.Millisecond,
+		o: []int64{2, 3, 4, 1},
+		f: []int64{2, 3, 4, 1},
+		k: 1,
+	},
+}
+
+func TestOrdered(t *testing.T) {
+	for _, tc := range orderedTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			var r recorder
+			o := output.NewOrdered(&r, tt.m, tt.w)
+			for i, seq := range tt.s {
+				if tt.w > 0 && i == len(tt.s)-2 {
+					time.Sleep(2 * tt.w)
+				}
+				if err := o.Write(seqResult(seq)); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if want, got := tt.o, []int64(r); !reflect.DeepEqual(want, got) {
+				t.Errorf("want results %v got %v", want, got)
+			}
+			if err := o.Flush(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want, got := tt.f, []int64(r); !reflect.DeepEqual(want, got) {
+				t.Errorf("want flushed results %v got %v", want, got)
+			}
+			if want, got := tt.k, o.Skipped(); want != got {
+				t.Errorf("want %d skipped got %d", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package output
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fgrimme/refurbed/notify"
+)
+
+// Summary is the aggregate of the results of a run.
+type Summary struct {
+	Read           int            `json:"read"`      // messages read from the input
+	Malformed      int            `json:"malformed"` // lines of the input which could not be parsed
+	Sent           int            `json:"sent"`      // messages with at least one attempt
+	Succeeded      int            `json:"succeeded"`
+	Failed         int            `json:"failed"`
+	Duplicates     int            `json:"duplicates"` // messages dropped as duplicates
+	FailedByClass  map[string]int `json:"failed_by_class"`
+	FailedByStatus map[int]int    `json:"failed_by_status"`
+	Retries        int            `json:"retries"`
+	Latency        Latency        `json:"latency"`
+	Throughput     float64        `json:"throughput"` // messages sent per second
+	Duration       float64        `json:"duration_s"`
+}
+
+// Latency holds percentiles of the total latency of requests in milliseconds.
+type Latency struct {
+	P50 float64 `json:"p50_ms"`
+	P95 float64 `json:"p95_ms"`
+	P99 float64 `json:"p99_ms"`
+}
+
+// latency buckets grow by 1%, so percentiles are accurate to about 1% while
+// the memory used is independent of the number of results.
+const bucketGrowth = 1.01
+
+// Collector is a Writer which aggregates results into a Summary. It is safe
+// for concurrent use.
+type Collector struct {
+	sync.Mutex
+	start   time.Time
+	summary Summary
+	buckets map[int]int // number of latencies per bucket
+}
+
+// NewCollector returns a Collector. The duration of the run is measured from
+// now on.
+func NewCollector() *Collector {
+	return &Collector{
+		start: time.Now(),
+		summary: Summary{
+			FailedByClass:  make(map[string]int),
+			FailedByStatus: make(map[int]int),
+		},
+		buckets: make(map[int]int),
+	}
+}
+
+func (c *Collector) Write(res notify.PostResult) error {
+	c.Lock()
+	defer c.Unlock()
+	if res.Duplicate {
+		c.summary.Duplicates++
+		return nil
+	}
+	if res.Attempts > 0 {
+		c.summary.Sent++
+		c.summary.Retries += res.Attempts - 1
+		c.buckets[bucket(res.Timing.Total)]++
+	}
+	if res.Err == nil {
+		c.summary.Succeeded++
+		return nil
+	}
+	c.summary.Failed++
+	c.summary.FailedByClass[notify.Classify(res.Err).Class]++
+	if res.StatusCode > 0 {
+		c.summary.FailedByStatus[res.StatusCode]++
+	}
+	return nil
+}
+
+// Summary returns the Summary of the results written so far. Read and
+// Malformed are not known from the results and are left to the caller.
+func (c *Collector) Summary() Summary {
+	c.Lock()
+	defer c.Unlock()
+	s := c.summary
+	s.FailedByClass = make(map[string]int, len(c.summary.FailedByClass))
+	for k, v := range c.summary.FailedByClass {
+		s.FailedByClass[k] = v
+	}
+	s.FailedByStatus = make(map[int]int, len(c.summary.FailedByStatus))
+	for k, v := range c.summary.FailedByStatus {
+		s.FailedByStatus[k] = v
+	}
+	d := time.Since(c.start)
+	s.Duration = d.Seconds()
+	if d > 0 {
+		s.Throughput = float64(s.Sent) / d.Seconds()
+	}
+	s.Latency = Latency{
+		P50: c.percentile(0.50),
+		P95: c.percentile(0.95),
+		P99: c.percentile(0.99),
+	}
+	return s
+}
+
+// percentile returns the upper bound of the bucket containing the p-th
+// latency.
+func (c *Collector) percentile(p float64) float64 {
+	var total int
+	keys := make([]int, 0, len(c.buckets))
+	for k, n := range c.buckets {
+		keys = append(keys, k)
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	sort.Ints(keys)
+	rank := int(math.Ceil(p * float64(total)))
+	var n int
+	for _, k := range keys {
+		n += c.buckets[k]
+		if n >= rank {
+			return math.Pow(bucketGrowth, float64(k))
+		}
+	}
+	return math.Pow(bucketGrowth, float64(keys[len(keys)-1]))
+}
+
+// bucket returns the index of the latency bucket of ms. Latencies below a
+// microsecond share a bucket.
+func bucket(ms float64) int {
+	if ms < 0.001 {
+		ms = 0.001
+	}
+	return int(math.Ceil(math.Log(ms) / math.Log(bucketGrowth)))
+}
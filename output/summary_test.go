@@ -0,0 +1,81 @@
+package output_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/fgrimme/refurbed/output"
+)
+
+func TestCollector(t *testing.T) {
+	c := output.NewCollector()
+	// 100 requests with latencies of 1 to 100ms, every tenth failed
+	for i := 1; i <= 100; i++ {
+		res := notify.PostResult{Attempts: 1, StatusCode: 200, Timing: notify.Timing{Total: float64(i)}}
+		if i%10 == 0 {
+			res.Attempts, res.StatusCode = 3, 503
+			res.Err = notify.PostErr{Err: "unavailable", Class: notify.ErrClassHTTPStatus}
+		}
+		if err := c.Write(res); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// canceled before the first attempt
+	_ = c.Write(notify.PostResult{Err: context.Canceled})
+	// dropped before the first attempt
+	_ = c.Write(notify.PostResult{Duplicate: true})
+
+	s := c.Summary()
+	if want, got := 100, s.Sent; want != got {
+		t.Errorf("want %d sent got %d", want, got)
+	}
+	if want, got := 90, s.Succeeded; want != got {
+		t.Errorf("want %d succeeded got %d", want, got)
+	}
+	if want, got := 11, s.Failed; want != got {
+		t.Errorf("want %d failed got %d", want, got)
+	}
+	if want, got := 1, s.Duplicates; want != got {
+		t.Errorf("want %d duplicates got %d", want, got)
+	}
+	if want, got := 10, s.FailedByClass[notify.ErrClassHTTPStatus]; want != got {
+		t.Errorf("want %d failed by class got %d", want, got)
+	}
+	if want, got := 1, s.FailedByClass[notify.ErrClassCanceled]; want != got {
+		t.Errorf("want %d canceled got %d", want, got)
+	}
+	if want, got := 10, s.FailedByStatus[503]; want != got {
+		t.Errorf("want %d failed by status got %d", want, got)
+	}
+	if want, got := 20, s.Retries; want != got {
+		t.Errorf("want %d retries got %d", want, got)
+	}
+
+	var percentileTests = []struct {
+		d string  // description of test case
+		w float64 // expected percentile
+		g float64 // percentile
+	}{
+		{d: "p50", w: 50, g: s.Latency.P50},
+		{d: "p95", w: 95, g: s.Latency.P95},
+		{d: "p99", w: 99, g: s.Latency.P99},
+	}
+	for _, tc := range percentileTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			// percentiles are accurate to about 1%
+			if math.Abs(tt.w-tt.g) > tt.w*0.011 {
+				t.Errorf("want %s %.2f got %.2f", tt.d, tt.w, tt.g)
+			}
+		})
+	}
+}
+
+func TestCollectorEmpty(t *testing.T) {
+	s := output.NewCollector().Summary()
+	if s.Sent != 0 || s.Latency.P99 != 0 {
+		t.Errorf("want empty summary got %+v", s)
+	}
+}
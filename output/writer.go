@@ -0,0 +1,224 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fgrimme/refurbed/notify"
+)
+
+// output formats.
+const (
+	FormatNDJSON = "ndjson" // one JSON encoded result per line
+	FormatCSV    = "csv"    // comma separated values with a header row
+	FormatTable  = "table"  // human readable, aligned columns
+	FormatQuiet  = "quiet"  // failed results only, one JSON encoded result per line
+)
+
+// Writer writes results.
+type Writer interface {
+	Write(res notify.PostResult) error
+}
+
+// NewWriter returns a Writer which writes results to w in the given format.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatNDJSON:
+		return &jsonWriter{enc: json.NewEncoder(w)}, nil
+	case FormatQuiet:
+		return &jsonWriter{enc: json.NewEncoder(w), failuresOnly: true}, nil
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatTable:
+		return newTableWriter(w)
+	}
+	return nil, fmt.Errorf("unsupported output format: %s", format)
+}
+
+// Split writes successful and failed results to different Writers. Results
+// are dropped if the respective Writer is nil. Duplicates are neither
+// successful nor failed, so they are dropped as well.
+type Split struct {
+	Success Writer
+	Failure Writer
+}
+
+func (s Split) Write(res notify.PostResult) error {
+	if res.Duplicate {
+		return nil
+	}
+	w := s.Success
+	if res.Err != nil {
+		w = s.Failure
+	}
+	if w == nil {
+		return nil
+	}
+	return w.Write(res)
+}
+
+// Multi writes results to all of its Writers. A failing Writer does not keep
+// the result from the others, so the errors of all Writers are returned.
+type Multi []Writer
+
+func (m Multi) Write(res notify.PostResult) error {
+	var errs []error
+	for _, w := range m {
+		if err := w.Write(res); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Synced serializes writes to W, so results can be written from multiple
+// goroutines.
+type Synced struct {
+	sync.Mutex
+	W Writer
+}
+
+func (s *Synced) Write(res notify.PostResult) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.W.Write(res)
+}
+
+type jsonWriter struct {
+	enc          *json.Encoder
+	failuresOnly bool
+}
+
+func (j *jsonWriter) Write(res notify.PostResult) error {
+	if j.failuresOnly && res.Err == nil {
+		return nil
+	}
+	return j.enc.Encode(res)
+}
+
+var csvHeader = []string{
+	"id", "status", "status_code", "attempts", "start", "total_ms",
+	"error_class", "error_message", "message",
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// headerWriter is implemented by writers which repeat a header at the start of
+// each file, e.g. after rotation.
+type headerWriter interface {
+	SetHeader(header []byte) error
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	if hw, ok := w.(headerWriter); ok {
+		// the header is written by the file itself
+		if err := hw.SetHeader([]byte(csvLine(csvHeader))); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	}
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.write(csvHeader); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (c *csvWriter) Write(res notify.PostResult) error {
+	status, class, msg := status(res)
+	return c.write([]string{
+		res.ID,
+		status,
+		strconv.Itoa(res.StatusCode),
+		strconv.Itoa(res.Attempts),
+		res.Start.Format(time.RFC3339Nano),
+		strconv.FormatFloat(res.Timing.Total, 'f', 3, 64),
+		class,
+		msg,
+		res.Msg,
+	})
+}
+
+// write writes and flushes a single record, so each result is written to
+// the underlying writer at once.
+func (c *csvWriter) write(record []string) error {
+	if err := c.w.Write(record); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvLine returns the CSV encoded record.
+func csvLine(record []string) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write(record) // writing to memory cannot fail
+	w.Flush()
+	return buf.String()
+}
+
+const tableFormat = "%-12s %-9s %4s %8s %10s  %-40s  %s\n"
+
+type tableWriter struct {
+	w io.Writer
+}
+
+func newTableWriter(w io.Writer) (*tableWriter, error) {
+	tw := &tableWriter{w: w}
+	if _, err := fmt.Fprintf(w, tableFormat, "ID", "STATUS", "CODE", "ATTEMPTS", "LATENCY", "MESSAGE", "ERROR"); err != nil {
+		return nil, err
+	}
+	return tw, nil
+}
+
+func (t *tableWriter) Write(res notify.PostResult) error {
+	status, class, msg := status(res)
+	if msg != "" {
+		class = class + ": " + msg
+	}
+	code := "-"
+	if res.StatusCode > 0 {
+		code = strconv.Itoa(res.StatusCode)
+	}
+	_, err := fmt.Fprintf(t.w, tableFormat,
+		res.ID,
+		status,
+		code,
+		strconv.Itoa(res.Attempts),
+		fmt.Sprintf("%.1fms", res.Timing.Total),
+		truncate(res.Msg, 40),
+		class,
+	)
+	return err
+}
+
+// status returns the status, error class and error message of a result.
+func status(res notify.PostResult) (string, string, string) {
+	if res.Duplicate {
+		return "duplicate", "", ""
+	}
+	if res.Err == nil {
+		return "ok", "", ""
+	}
+	info := notify.Classify(res.Err)
+	return "failed", info.Class, info.Message
+}
+
+// truncate shortens s to n runes.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
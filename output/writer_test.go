@@ -0,0 +1,117 @@
+package output_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/fgrimme/refurbed/output"
+)
+
+var results = []notify.PostResult{
+	{ID: "1", Msg: "foo", StatusCode: 200, Attempts: 1},
+	{ID: "2", Msg: "bar, baz", Attempts: 1, Err: context.DeadlineExceeded},
+}
+
+var writerTests = []struct {
+	d string   // description of test case
+	f string   // output format
+	o []string // expected lines
+}{
+	{
+		d: "expect one JSON object per line",
+		f: output.FormatNDJSON,
+		o: []string{`{"id":"1"`, `{"id":"2"`},
+	},
+	{
+		d: "expect failures only",
+		f: output.FormatQuiet,
+		o: []string{`{"id":"2"`},
+	},
+	{
+		d: "expect CSV with header row",
+		f: output.FormatCSV,
+		o: []string{
+			"id,status,status_code,attempts,start,total_ms,error_class,error_message,message",
+			"1,ok,200,1,",
+			"2,failed,0,1,",
+		},
+	},
+	{
+		d: "expect table with header row",
+		f: output.FormatTable,
+		o: []string{"ID ", "1 ", "2 "},
+	},
+}
+
+func TestWriter(t *testing.T) {
+	for _, tc := range writerTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := output.NewWriter(tt.f, &buf)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, res := range results {
+				if err := w.Write(res); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if want, got := len(tt.o), len(lines); want != got {
+				t.Fatalf("want %d lines got %d:\n%s", want, got, buf.String())
+			}
+			for i, prefix := range tt.o {
+				if !strings.HasPrefix(lines[i], prefix) {
+					t.Errorf("want line %d to start with %q got %q", i, prefix, lines[i])
+				}
+			}
+		})
+	}
+
+	if _, err := output.NewWriter("xml", &bytes.Buffer{}); err == nil {
+		t.Error("expect error for unsupported format")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	var success, failure bytes.Buffer
+	sw, _ := output.NewWriter(output.FormatNDJSON, &success)
+	fw, _ := output.NewWriter(output.FormatNDJSON, &failure)
+	w := output.Split{Success: sw, Failure: fw}
+	for _, res := range results {
+		if err := w.Write(res); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if !strings.HasPrefix(success.String(), `{"id":"1"`) || strings.Count(success.String(), "\n") != 1 {
+		t.Errorf("want success in success output got %q", success.String())
+	}
+	if !strings.HasPrefix(failure.String(), `{"id":"2"`) || strings.Count(failure.String(), "\n") != 1 {
+		t.Errorf("want failure in failure output got %q", failure.String())
+	}
+}
+
+// failing is a Writer which always fails.
+type failing struct{}
+
+func (failing) Write(res notify.PostResult) error {
+	return errors.New("disk full")
+}
+
+func TestMulti(t *testing.T) {
+	c := output.NewCollector()
+	w := output.Multi{failing{}, c, failing{}}
+	err := w.Write(results[1])
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	// the Writers after the failing one see the result anyway
+	if want, got := 1, c.Summary().Failed; want != got {
+		t.Errorf("want %d failed got %d", want, got)
+	}
+}
@@ -0,0 +1,112 @@
+package replay
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/fgrimme/refurbed/scan"
+)
+
+// Record is an entry of a results or dead-letter file. Results carry the
+// message in Msg, dead letters in Body.
+type Record struct {
+	ID         string            `json:"id"`
+	Msg        *string           `json:"message"`
+	MsgHeaders map[string]string `json:"message_headers"`
+	Body       string            `json:"body"`
+	Headers    map[string]string `json:"headers"`
+	StatusCode int               `json:"status_code"`
+	Error      *notify.ErrorInfo `json:"error"`
+	Start      time.Time         `json:"start"`
+	FailedAt   time.Time         `json:"failed_at"`
+}
+
+// Message returns the message of the record.
+func (r Record) Message() message.Message {
+	if r.Msg != nil {
+		return message.Message{ID: r.ID, Body: *r.Msg, Headers: r.MsgHeaders}
+	}
+	return message.Message{ID: r.ID, Body: r.Body, Headers: r.Headers}
+}
+
+// Time returns the start time of the record. Dead letters written before they
+// had a start time use their time of failure.
+func (r Record) Time() time.Time {
+	if !r.Start.IsZero() {
+		return r.Start
+	}
+	return r.FailedAt
+}
+
+// Filter selects records. Records must match all criteria which are set.
+type Filter struct {
+	FailedOnly  bool            // records with an error
+	StatusCodes []int           // records with one of the status codes
+	Classes     []string        // records with one of the error classes
+	Since       time.Time       // records at or after
+	Until       time.Time       // records before
+	IDs         map[string]bool // records with one of the IDs
+}
+
+// Match reports whether r is selected by the Filter.
+func (f Filter) Match(r Record) bool {
+	if f.FailedOnly && r.Error == nil {
+		return false
+	}
+	if len(f.StatusCodes) > 0 && !containsInt(f.StatusCodes, r.StatusCode) {
+		return false
+	}
+	if len(f.Classes) > 0 && (r.Error == nil || !containsString(f.Classes, r.Error.Class)) {
+		return false
+	}
+	if !f.Since.IsZero() && r.Time().Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !r.Time().Before(f.Until) {
+		return false
+	}
+	if len(f.IDs) > 0 && !f.IDs[r.ID] {
+		return false
+	}
+	return true
+}
+
+// Parser returns a ParseFunc which reads records and returns the messages of
+// those selected by f. Other records are skipped.
+func Parser(f Filter) scan.ParseFunc {
+	return func(line int, text string) (message.Message, error) {
+		var r Record
+		if err := json.Unmarshal([]byte(text), &r); err != nil {
+			return message.Message{}, err
+		}
+		if !f.Match(r) {
+			return message.Message{}, scan.ErrSkip
+		}
+		m := r.Message()
+		if m.ID == "" {
+			m.ID = strconv.Itoa(line)
+		}
+		return m, nil
+	}
+}
+
+func containsInt(s []int, v int) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(s []string, v string) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
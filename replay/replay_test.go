@@ -0,0 +1,111 @@
+package replay_test
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/replay"
+	"github.com/fgrimme/refurbed/scan"
+	"github.com/rs/zerolog"
+)
+
+// results and dead letters as written by a previous run
+const records = `{"id":"1","message":"foo","status_code":200,"start":"2019-10-16T10:00:00Z","error":null}
+{"id":"2","message":"bar","message_headers":{"X-Foo":"bar"},"status_code":503,"start":"2019-10-16T11:00:00Z","error":{"class":"http_status","message":"unavailable","retryable":true}}
+{"id":"3","message":"baz","start":"2019-10-16T12:00:00Z","error":{"class":"timeout","message":"context deadline exceeded","retryable":true}}
+{"id":"4","body":"qux","error":{"class":"connection_refused","message":"refused","retryable":true},"attempts":3,"failed_at":"2019-10-16T13:00:00Z"}
+{"id":"5","body":"quux","status_code":503,"error":{"class":"http_status","message":"unavailable","retryable":true},"attempts":3,"start":"2019-10-16T11:30:00Z","failed_at":"2019-10-16T13:30:00Z"}
+not json
+`
+
+func date(hour int) time.Time {
+	return time.Date(2019, 10, 16, hour, 0, 0, 0, time.UTC)
+}
+
+var replayTests = []struct {
+	d string        // description of test case
+	f replay.Filter // filter
+	i []string      // expected message IDs
+}{
+	{
+		d: "expect all records without filter",
+		i: []string{"1", "2", "3", "4", "5"},
+	},
+	{
+		d: "expect failed records only",
+		f: replay.Filter{FailedOnly: true},
+		i: []string{"2", "3", "4", "5"},
+	},
+	{
+		d: "expect records with status code",
+		f: replay.Filter{StatusCodes: []int{503}},
+		i: []string{"2", "5"},
+	},
+	{
+		d: "expect records with error class",
+		f: replay.Filter{Classes: []string{"timeout", "connection_refused"}},
+		i: []string{"3", "4"},
+	},
+	{
+		d: "expect records within time range",
+		f: replay.Filter{Since: date(11), Until: date(13)},
+		i: []string{"2", "3", "5"},
+	},
+	{
+		d: "expect records with ID",
+		f: replay.Filter{IDs: map[string]bool{"1": true, "4": true}},
+		i: []string{"1", "4"},
+	},
+}
+
+func TestParser(t *testing.T) {
+	for _, tc := range replayTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			s := scan.NewParseScanner(strings.NewReader(records), replay.Parser(tt.f), zerolog.New(ioutil.Discard))
+			q, errc := s.Run()
+			if err := <-errc; err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var ids []string
+			for !q.IsExhausted() {
+				ids = append(ids, q.Pop().ID)
+			}
+			if want, got := tt.i, ids; !reflect.DeepEqual(want, got) {
+				t.Errorf("want IDs %v got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestRecordMessage(t *testing.T) {
+	msg := "bar"
+	var recordTests = []struct {
+		d string          // description of test case
+		r replay.Record   // record
+		m message.Message // expected message
+	}{
+		{
+			d: "expect message of result",
+			r: replay.Record{ID: "1", Msg: &msg, MsgHeaders: map[string]string{"X-Foo": "bar"}},
+			m: message.Message{ID: "1", Body: "bar", Headers: map[string]string{"X-Foo": "bar"}},
+		},
+		{
+			d: "expect message of dead letter",
+			r: replay.Record{ID: "2", Body: "baz"},
+			m: message.Message{ID: "2", Body: "baz"},
+		},
+	}
+	for _, tc := range recordTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			if want, got := tt.m, tt.r.Message(); !reflect.DeepEqual(want, got) {
+				t.Errorf("want message %+v got %+v", want, got)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package scan
 import (
 	"container/list"
 	"sync"
+
+	"github.com/fgrimme/refurbed/message"
 )
 
 // Queue is a FIFO list, safe for concurrent access.
@@ -18,24 +20,45 @@ func NewQueue() *Queue {
 	}
 }
 
-func (q *Queue) Push(s string) {
+func (q *Queue) Push(m message.Message) {
 	q.Lock()
-	q.list.PushBack(s)
+	q.list.PushBack(m)
 	q.Unlock()
 }
 
-func (q *Queue) Pop() string {
-	var v string
+// Pop removes and returns the first message of the queue.
+// If the queue is empty, the zero value is returned.
+func (q *Queue) Pop() message.Message {
+	var v message.Message
 	q.Lock()
 	e := q.list.Front()
 	if e != nil {
-		v = e.Value.(string)
+		v = e.Value.(message.Message)
 		q.list.Remove(e)
 	}
 	q.Unlock()
 	return v
 }
 
+// Len returns the number of messages in the queue.
+func (q *Queue) Len() int {
+	q.RLock()
+	defer q.RUnlock()
+	return q.list.Len()
+}
+
+// Drain removes and returns all messages of the queue.
+func (q *Queue) Drain() []message.Message {
+	q.Lock()
+	defer q.Unlock()
+	msgs := make([]message.Message, 0, q.list.Len())
+	for e := q.list.Front(); e != nil; e = e.Next() {
+		msgs = append(msgs, e.Value.(message.Message))
+	}
+	q.list.Init()
+	return msgs
+}
+
 // IsExhausted determines if all elements of the queue
 // have been consumed and no future pushes are intended.
 func (q *Queue) IsExhausted() bool {
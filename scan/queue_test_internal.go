@@ -1,6 +1,10 @@
 package scan
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/fgrimme/refurbed/message"
+)
 
 var queueTests = []struct {
 	d    string // test case description
@@ -36,11 +40,11 @@ func TestQueue(t *testing.T) {
 		tt := tc
 		t.Run(tt.d, func(t *testing.T) {
 			if tt.push != "" {
-				q.Push(tc.push)
+				q.Push(message.Message{Body: tc.push})
 			}
 			if tt.pop != "" {
-				s := q.Pop()
-				if want, got := tt.pop, s; want != got {
+				m := q.Pop()
+				if want, got := tt.pop, m.Body; want != got {
 					t.Errorf("want pop %s got %s", want, got)
 				}
 			}
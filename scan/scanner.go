@@ -2,61 +2,196 @@ package scan
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"io"
+	"strconv"
+	"sync/atomic"
 
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/tracing"
 	"github.com/rs/zerolog"
 )
 
-// Scanner reads lines from an io.Reader.
+// ErrSkip is returned by a ParseFunc for lines which are valid, but are not
+// meant to be sent.
+var ErrSkip = errors.New("skip line")
+
+// ParseFunc parses the text of a line into a message. The line number starts
+// at 1.
+type ParseFunc func(line int, text string) (message.Message, error)
+
+// Scanner reads lines from one or more io.Readers.
 type Scanner struct {
-	in     io.Reader
+	inputs []io.Reader
 	queue  *Queue
 	quit   chan struct{}
+	parse  ParseFunc
 	logger zerolog.Logger
+
+	read      int64 // messages pushed to the queue
+	malformed int64 // lines which could not be parsed
+
+	// position of the io.Reader in the input
+	offset int64
+	line   int
 }
 
+// NewScanner returns a Scanner which reads plain text messages, one per line.
 func NewScanner(in io.Reader, logger zerolog.Logger) *Scanner {
+	return NewParseScanner(in, parseText, logger)
+}
+
+// NewJSONScanner returns a Scanner which reads JSON encoded messages, one per
+// line (JSON Lines). This is the format of dead-letter files. Messages without
+// an ID are identified by their line number.
+func NewJSONScanner(in io.Reader, logger zerolog.Logger) *Scanner {
+	return NewParseScanner(in, parseJSON, logger)
+}
+
+// NewParseScanner returns a Scanner which parses each line with parse.
+func NewParseScanner(in io.Reader, parse ParseFunc, logger zerolog.Logger) *Scanner {
+	return NewMultiScanner([]io.Reader{in}, parse, logger)
+}
+
+// NewMultiScanner returns a Scanner which reads the inputs one after another
+// and parses each line with parse. Each input is scanned separately, i.e. a
+// last line without a newline ends with its input, and line numbers start at
+// 1 for each input.
+func NewMultiScanner(inputs []io.Reader, parse ParseFunc, logger zerolog.Logger) *Scanner {
 	return &Scanner{
-		in:     in,
+		inputs: inputs,
 		queue:  NewQueue(),
 		quit:   make(chan struct{}, 2),
+		parse:  parse,
 		logger: logger,
 	}
 }
 
-// Run reads from the Scanners io.Reader until it reaches EOF or a quit signal.
+func parseText(line int, text string) (message.Message, error) {
+	return message.Message{
+		ID:   strconv.Itoa(line),
+		Body: text,
+	}, nil
+}
+
+func parseJSON(line int, text string) (message.Message, error) {
+	var m message.Message
+	if err := json.Unmarshal([]byte(text), &m); err != nil {
+		return m, err
+	}
+	if m.ID == "" {
+		m.ID = strconv.Itoa(line)
+	}
+	return m, nil
+}
+
+// StartAt sets the position of the io.Reader in the input, e.g. after seeking
+// to a checkpoint, so the positions and line numbers of the messages continue
+// from there. It must be called before Run.
+func (s *Scanner) StartAt(offset int64, line int) {
+	s.offset, s.line = offset, line
+}
+
+// Run reads from the Scanners inputs one after another until it reaches EOF
+// of the last input, an error or a quit signal. Each non-empty line becomes
+// a message identified by its line number.
 // Note: We assume a line can fit into the scanner's buffer/token-size (64*1024B).
 func (s *Scanner) Run() (*Queue, chan error) {
 	s.logger.Info().Msg("start scanner")
-	scanner := bufio.NewScanner(s.in)
 	errC := make(chan error)
 	go func() {
-		defer func() { errC <- scanner.Err() }()
-		for {
-			select {
-			case <-s.quit:
-				s.queue.setReady()
-				s.logger.Info().Str("term", "SIGTERM").Msg("stop scanner")
+		var (
+			seq int64
+			err error
+		)
+		for i, in := range s.inputs {
+			// the position of the first input may continue a previous run
+			var offset int64
+			var line int
+			if i == 0 {
+				offset, line = s.offset, s.line
+			}
+			var stopped bool
+			if stopped, err = s.scan(in, offset, line, &seq); stopped {
+				errC <- nil
 				return
-			default:
-				if scanner.Scan() {
-					msg := scanner.Text()
-					if len(msg) == 0 {
-						continue
-					}
-					s.queue.Push(msg)
-				} else {
-					s.queue.setReady()
-					s.logger.Info().Str("term", "EOF").Msg("stop scanner")
-					return
-				}
+			}
+			if err != nil {
+				break
 			}
 		}
+		s.queue.setReady()
+		s.logger.Info().Str("term", "EOF").Msg("stop scanner")
+		errC <- err
 	}()
 	return s.queue, errC
 }
 
+// scan reads the lines of in, starting at offset and line, until it reaches
+// EOF or an error. It reports whether it was stopped by a quit signal. The
+// number of the last message is kept in seq.
+func (s *Scanner) scan(in io.Reader, offset int64, line int, seq *int64) (bool, error) {
+	scanner := bufio.NewScanner(in)
+	// we count the bytes consumed by each line to track the offset
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		offset += int64(advance)
+		return advance, token, err
+	})
+	for {
+		select {
+		case <-s.quit:
+			s.queue.setReady()
+			s.logger.Info().Str("term", "SIGTERM").Msg("stop scanner")
+			return true, nil
+		default:
+			if !scanner.Scan() {
+				return false, scanner.Err()
+			}
+			line++
+			text := scanner.Text()
+			if len(text) == 0 {
+				continue
+			}
+			msg, err := s.parse(line, text)
+			if err == ErrSkip {
+				continue
+			}
+			if err != nil {
+				// malformed lines are skipped
+				s.logger.Error().Err(err).Int("line", line).Msg("parse message")
+				atomic.AddInt64(&s.malformed, 1)
+				continue
+			}
+			// messages without a body are never sent, so they get no
+			// position and no trace
+			if msg.Body != "" {
+				*seq++
+				msg.Pos = message.Position{Seq: *seq, Line: line, Offset: offset}
+				msg = tracing.Start(msg, "queue")
+			}
+			s.queue.Push(msg)
+			atomic.AddInt64(&s.read, 1)
+		}
+	}
+}
+
+// Read returns the number of messages read so far.
+func (s *Scanner) Read() int {
+	return int(atomic.LoadInt64(&s.read))
+}
+
+// Malformed returns the number of lines which could not be parsed so far.
+func (s *Scanner) Malformed() int {
+	return int(atomic.LoadInt64(&s.malformed))
+}
+
+// Stop stops reading. The queue is marked as complete at once, even if the
+// read loop is blocked by the io.Reader, so the queued messages can still be
+// consumed until the queue is exhausted.
 func (s *Scanner) Stop() {
+	s.queue.setReady()
 	s.quit <- struct{}{}
 	close(s.quit)
 }
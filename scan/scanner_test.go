@@ -1,23 +1,27 @@
 package scan_test
 
 import (
+	"io"
 	"io/ioutil"
 	"log"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/fgrimme/refurbed/message"
 	"github.com/fgrimme/refurbed/scan"
 	"github.com/rs/zerolog"
 	"go.uber.org/goleak"
 )
 
-var scanTests = []string{
-	"foo 1",
-	"foo 2",
-	"foo 3",
-	"bar 1",
-	"bar 2",
-	"bar 3",
+var scanTests = []message.Message{
+	{ID: "2", Body: "foo 1", Pos: message.Position{Seq: 1, Line: 2, Offset: 7}},
+	{ID: "3", Body: "foo 2", Pos: message.Position{Seq: 2, Line: 3, Offset: 13}},
+	{ID: "4", Body: "foo 3", Pos: message.Position{Seq: 3, Line: 4, Offset: 19}},
+	{ID: "5", Body: "bar 1", Pos: message.Position{Seq: 4, Line: 5, Offset: 25}},
+	{ID: "6", Body: "bar 2", Pos: message.Position{Seq: 5, Line: 6, Offset: 31}},
+	{ID: "7", Body: "bar 3", Pos: message.Position{Seq: 6, Line: 7, Offset: 37}},
 }
 
 func TestRun(t *testing.T) {
@@ -40,8 +44,8 @@ bar 3
 		t.Errorf("unexpected err: %v\n", err)
 	}
 	for _, tc := range scanTests {
-		if want, got := tc, q.Pop(); want != got {
-			t.Errorf("expected: %s got: %s\n", want, got)
+		if want, got := tc, q.Pop(); !reflect.DeepEqual(want, got) {
+			t.Errorf("expected: %+v got: %+v\n", want, got)
 		}
 	}
 	// we don't receive an EOF from the strings.Reader so we need
@@ -52,6 +56,112 @@ bar 3
 	}
 }
 
+var scanJSONTests = []message.Message{
+	{ID: "a", Body: "foo 1", Headers: map[string]string{"X-Foo": "bar"}, Pos: message.Position{Seq: 1, Line: 1, Offset: 89}},
+	{ID: "3", Body: "foo 2", Pos: message.Position{Seq: 2, Line: 3, Offset: 116}},
+}
+
+func TestRunJSON(t *testing.T) {
+	in := `{"id": "a", "body": "foo 1", "headers": {"X-Foo": "bar"}, "error": {"class": "timeout"}}
+not json
+{"body": "foo 2"}
+`
+	l := zerolog.New(ioutil.Discard)
+	s := scan.NewJSONScanner(strings.NewReader(in), l)
+	q, errc := s.Run()
+	if err := <-errc; err != nil {
+		t.Errorf("unexpected err: %v\n", err)
+	}
+	// malformed lines are skipped
+	for _, tc := range scanJSONTests {
+		if want, got := tc, q.Pop(); !reflect.DeepEqual(want, got) {
+			t.Errorf("expected: %+v got: %+v\n", want, got)
+		}
+	}
+	if want, got := 2, s.Read(); want != got {
+		t.Errorf("want %d messages read got %d", want, got)
+	}
+	if want, got := 1, s.Malformed(); want != got {
+		t.Errorf("want %d malformed lines got %d", want, got)
+	}
+	s.Stop()
+	if !q.IsExhausted() {
+		t.Error("expect queue to be exhausted")
+	}
+}
+
+func TestStartAt(t *testing.T) {
+	l := zerolog.New(ioutil.Discard)
+	s := scan.NewScanner(strings.NewReader("foo\nbar\n"), l)
+	// the reader continues a previous run after line 10
+	s.StartAt(100, 10)
+	q, errc := s.Run()
+	if err := <-errc; err != nil {
+		t.Errorf("unexpected err: %v\n", err)
+	}
+	for _, tc := range []message.Message{
+		{ID: "11", Body: "foo", Pos: message.Position{Seq: 1, Line: 11, Offset: 104}},
+		{ID: "12", Body: "bar", Pos: message.Position{Seq: 2, Line: 12, Offset: 108}},
+	} {
+		if want, got := tc, q.Pop(); !reflect.DeepEqual(want, got) {
+			t.Errorf("expected: %+v got: %+v\n", want, got)
+		}
+	}
+	s.Stop()
+}
+
+func TestMultiScanner(t *testing.T) {
+	l := zerolog.New(ioutil.Discard)
+	parse := func(line int, text string) (message.Message, error) {
+		return message.Message{ID: text, Body: text}, nil
+	}
+	// the last line of the first input has no newline
+	s := scan.NewMultiScanner([]io.Reader{
+		strings.NewReader("foo\nbar"),
+		strings.NewReader("baz\n"),
+	}, parse, l)
+	q, errc := s.Run()
+	if err := <-errc; err != nil {
+		t.Errorf("unexpected err: %v\n", err)
+	}
+	for _, tc := range []message.Message{
+		{ID: "foo", Body: "foo", Pos: message.Position{Seq: 1, Line: 1, Offset: 4}},
+		{ID: "bar", Body: "bar", Pos: message.Position{Seq: 2, Line: 2, Offset: 7}},
+		{ID: "baz", Body: "baz", Pos: message.Position{Seq: 3, Line: 1, Offset: 4}},
+	} {
+		if want, got := tc, q.Pop(); !reflect.DeepEqual(want, got) {
+			t.Errorf("expected: %+v got: %+v\n", want, got)
+		}
+	}
+	if !q.IsExhausted() {
+		t.Error("expect queue to be exhausted")
+	}
+}
+
+func TestStop(t *testing.T) {
+	l := zerolog.New(ioutil.Discard)
+	r, w := io.Pipe()
+	s := scan.NewScanner(r, l)
+	q, errc := s.Run()
+	if _, err := w.Write([]byte("foo\n")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	for q.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// the read loop is blocked by the reader, nevertheless the queue is
+	// complete once its messages are consumed
+	s.Stop()
+	if want, got := "foo", q.Pop().Body; want != got {
+		t.Errorf("want body %q got %q", want, got)
+	}
+	if !q.IsExhausted() {
+		t.Error("expect queue to be exhausted")
+	}
+	w.Close()
+	<-errc
+}
+
 // we test for leaking go routines
 func TestMain(m *testing.M) {
 	goleak.VerifyTestMain(m)
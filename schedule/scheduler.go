@@ -1,21 +1,30 @@
 package schedule
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/tracing"
 	"github.com/rs/zerolog"
 )
 
 type queue interface {
 	IsExhausted() bool
-	Pop() string
+	Pop() message.Message
 }
 
 // Scheduler schedules send operations to a queue.
 type Scheduler struct {
+	sync.Mutex
 	interval time.Duration
+	ticker   *time.Ticker // nil until Run is called
+	paused   bool
 	quit     chan struct{}
 	logger   zerolog.Logger
+	emitted  int64 // messages sent to the outbound channel
 }
 
 func NewScheduler(interval time.Duration, logger zerolog.Logger) *Scheduler {
@@ -29,9 +38,12 @@ func NewScheduler(interval time.Duration, logger zerolog.Logger) *Scheduler {
 // Run reads from q and sends to an outbound channel once per interval until the
 // queue is exhausted or a quit signal is received. It closes the outbound channel
 // when the read loop terminates.
-func (s *Scheduler) Run(q queue) chan string {
-	ticker := time.NewTicker(s.interval)
-	out := make(chan string)
+func (s *Scheduler) Run(q queue) chan message.Message {
+	s.Lock()
+	s.ticker = time.NewTicker(s.interval)
+	ticker := s.ticker
+	s.Unlock()
+	out := make(chan message.Message)
 	s.logger.Info().Msg("start scheduler")
 	go func() {
 		defer close(out)
@@ -46,9 +58,17 @@ func (s *Scheduler) Run(q queue) chan string {
 					s.logger.Info().Str("term", "FIN").Msg("stop scheduler")
 					return
 				}
+				if s.Paused() {
+					continue
+				}
 				msg := q.Pop()
-				if len(msg) > 0 {
+				if len(msg.Body) > 0 {
+					// the schedule stage lasts from dequeuing the message
+					// until it is emitted
+					msg = tracing.Stage(msg, "schedule")
 					out <- msg
+					tracing.EndStage(msg, "schedule")
+					atomic.AddInt64(&s.emitted, 1)
 				}
 			}
 		}
@@ -56,6 +76,58 @@ func (s *Scheduler) Run(q queue) chan string {
 	return out
 }
 
+// Pause stops sending messages until Resume is called. Messages stay in the
+// queue.
+func (s *Scheduler) Pause() {
+	s.Lock()
+	s.paused = true
+	s.Unlock()
+	s.logger.Info().Msg("pause scheduler")
+}
+
+// Resume continues sending messages after Pause.
+func (s *Scheduler) Resume() {
+	s.Lock()
+	s.paused = false
+	s.Unlock()
+	s.logger.Info().Msg("resume scheduler")
+}
+
+// Paused reports whether the Scheduler is paused.
+func (s *Scheduler) Paused() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.paused
+}
+
+// SetInterval changes the interval between messages. It takes effect with
+// the next tick, also while the Scheduler is running.
+func (s *Scheduler) SetInterval(d time.Duration) error {
+	if d <= 0 {
+		return errors.New("interval must be > 0")
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.interval = d
+	if s.ticker != nil {
+		s.ticker.Reset(d)
+	}
+	s.logger.Info().Dur("interval", d).Msg("set scheduler interval")
+	return nil
+}
+
+// Interval returns the interval between messages.
+func (s *Scheduler) Interval() time.Duration {
+	s.Lock()
+	defer s.Unlock()
+	return s.interval
+}
+
+// Emitted returns the number of messages sent to the outbound channel so far.
+func (s *Scheduler) Emitted() int {
+	return int(atomic.LoadInt64(&s.emitted))
+}
+
 func (s *Scheduler) Stop() {
 	s.quit <- struct{}{}
 	defer close(s.quit)
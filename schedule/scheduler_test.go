@@ -47,13 +47,55 @@ bar 3
 	sc := schedule.NewScheduler(10*time.Millisecond, l)
 	out := sc.Run(q)
 	for _, tc := range schedulerTests {
-		if want, got := tc, <-out; want != got {
+		if want, got := tc, (<-out).Body; want != got {
 			t.Errorf("expected: %s got: %s\n", want, got)
 		}
 	}
+	if want, got := len(schedulerTests), sc.Emitted(); want != got {
+		t.Errorf("expected %d emitted messages got %d\n", want, got)
+	}
 	sc.Stop()
 }
 
+func TestPause(t *testing.T) {
+	l := zerolog.New(ioutil.Discard)
+	s := scan.NewScanner(strings.NewReader("foo\nbar\n"), l)
+	q, errc := s.Run()
+	if err := <-errc; err != nil {
+		t.Errorf("unexpected err: %v\n", err)
+	}
+	s.Stop()
+
+	sc := schedule.NewScheduler(time.Millisecond, l)
+	sc.Pause()
+	out := sc.Run(q)
+	select {
+	case msg := <-out:
+		t.Errorf("unexpected message while paused: %v\n", msg.Body)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if want, got := 2, q.Len(); want != got {
+		t.Errorf("expected %d queued messages got %d\n", want, got)
+	}
+
+	if err := sc.SetInterval(0); err == nil {
+		t.Error("expected error for interval 0")
+	}
+	if err := sc.SetInterval(2 * time.Millisecond); err != nil {
+		t.Errorf("unexpected err: %v\n", err)
+	}
+	sc.Resume()
+	for _, want := range []string{"foo", "bar"} {
+		if got := (<-out).Body; want != got {
+			t.Errorf("expected: %s got: %s\n", want, got)
+		}
+	}
+	// the outbound channel is closed when the queue is exhausted
+	if _, ok := <-out; ok {
+		t.Error("expected outbound channel to be closed")
+	}
+}
+
 // we test for leaking go routines
 func TestMain(m *testing.M) {
 	goleak.VerifyTestMain(m)
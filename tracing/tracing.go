@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"github.com/fgrimme/refurbed/message"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the name of the tracer used by all stages of the pipeline
+const instrumentation = "github.com/fgrimme/refurbed"
+
+// Tracer returns the Tracer of the pipeline. Spans are dropped unless a
+// TracerProvider is registered with otel.SetTracerProvider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// traces holds the traces of the messages in the pipeline by their
+// message.Trace. A trace is removed once it is ended.
+var traces = struct {
+	sync.Mutex
+	last uint64
+	m    map[uint64]*msgTrace
+}{m: make(map[uint64]*msgTrace)}
+
+// msgTrace is the trace of a message.
+type msgTrace struct {
+	span  trace.Span // of the message
+	stage trace.Span // of the current stage, nil between stages
+	name  string     // of the current stage
+}
+
+// Start starts the span of m and the span of its first stage. The span of
+// the message lasts until End is called. If the span is not recorded, e.g.
+// since tracing is disabled, m is returned as it is.
+func Start(m message.Message, stage string) message.Message {
+	_, span := Tracer().Start(context.Background(), "message",
+		trace.WithAttributes(attribute.String("message.id", m.ID)))
+	if !span.IsRecording() {
+		return m
+	}
+	t := &msgTrace{span: span}
+	t.startStage(stage)
+	traces.Lock()
+	traces.last++
+	m.Trace = traces.last
+	traces.m[m.Trace] = t
+	traces.Unlock()
+	return m
+}
+
+// Stage ends the current stage of m and starts the next one. If the trace of
+// m has not been started yet, it is started.
+func Stage(m message.Message, stage string) message.Message {
+	traces.Lock()
+	t, ok := traces.m[m.Trace]
+	if ok {
+		t.endStage()
+		t.startStage(stage)
+	}
+	traces.Unlock()
+	if !ok {
+		return Start(m, stage)
+	}
+	return m
+}
+
+// EndStage ends the current stage of m if it is stage. Until the next stage
+// starts, new spans are children of the span of the message.
+func EndStage(m message.Message, stage string) {
+	traces.Lock()
+	defer traces.Unlock()
+	if t, ok := traces.m[m.Trace]; ok && t.name == stage {
+		t.endStage()
+	}
+}
+
+// End ends the current stage and the span of m. A non-nil err is recorded
+// in the span of the message.
+func End(m message.Message, err error) {
+	traces.Lock()
+	t, ok := traces.m[m.Trace]
+	delete(traces.m, m.Trace)
+	traces.Unlock()
+	if ok {
+		t.end(err)
+	}
+}
+
+// EndAll ends the traces of all messages which have not been ended, e.g. of
+// messages which were not sent before the shutdown. err is recorded in their
+// spans.
+func EndAll(err error) {
+	traces.Lock()
+	ended := traces.m
+	traces.m = make(map[uint64]*msgTrace)
+	traces.Unlock()
+	for _, t := range ended {
+		t.end(err)
+	}
+}
+
+// Context returns a copy of ctx in which the span of the current stage of m,
+// or the span of m between stages, is the parent of new spans.
+func Context(ctx context.Context, m message.Message) context.Context {
+	traces.Lock()
+	defer traces.Unlock()
+	t, ok := traces.m[m.Trace]
+	if !ok {
+		return ctx
+	}
+	if t.stage != nil {
+		return trace.ContextWithSpan(ctx, t.stage)
+	}
+	return trace.ContextWithSpan(ctx, t.span)
+}
+
+// Batch starts the span of a batch request in ctx. The span is linked to the
+// current stages of the messages of the batch.
+func Batch(ctx context.Context, msgs []message.Message) (context.Context, trace.Span) {
+	links := make([]trace.Link, 0, len(msgs))
+	for _, m := range msgs {
+		if sc := trace.SpanContextFromContext(Context(context.Background(), m)); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	return Tracer().Start(ctx, "batch",
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("batch.size", len(msgs))))
+}
+
+func (t *msgTrace) startStage(stage string) {
+	_, t.stage = Tracer().Start(trace.ContextWithSpan(context.Background(), t.span), stage)
+	t.name = stage
+}
+
+func (t *msgTrace) endStage() {
+	if t.stage != nil {
+		t.stage.End()
+	}
+	t.stage, t.name = nil, ""
+}
+
+func (t *msgTrace) end(err error) {
+	t.endStage()
+	if err != nil {
+		t.span.RecordError(err)
+		t.span.SetStatus(codes.Error, err.Error())
+	}
+	t.span.End()
+}
@@ -0,0 +1,130 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fgrimme/refurbed/message"
+	"github.com/fgrimme/refurbed/notify"
+	"github.com/fgrimme/refurbed/scan"
+	"github.com/fgrimme/refurbed/schedule"
+	"github.com/fgrimme/refurbed/tracing"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestPipeline(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+
+	traceparent := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent <- r.Header.Get("traceparent")
+	}))
+	defer srv.Close()
+
+	l := zerolog.New(ioutil.Discard)
+	s := scan.NewScanner(strings.NewReader("foo\n"), l)
+	q, errc := s.Run()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc, err := notify.NewService(notify.NewHttpClient(srv.URL), time.Second, 1, l)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for res := range svc.Run(context.Background(), schedule.NewScheduler(time.Millisecond, l).Run(q)) {
+		if res.Err != nil {
+			t.Errorf("unexpected error: %v", res.Err)
+		}
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exp.GetSpans() {
+		spans[span.Name] = span
+	}
+	msg := spans["message"]
+	if !msg.SpanContext.IsValid() {
+		t.Fatalf("want message span got %v", exp.GetSpans())
+	}
+
+	var spanTests = []struct {
+		d string // description of test case
+		n string // span name
+		p string // name of the parent span
+	}{
+		{d: "expect queue stage", n: "queue", p: "message"},
+		{d: "expect schedule stage", n: "schedule", p: "message"},
+		{d: "expect notify stage", n: "notify", p: "message"},
+		{d: "expect attempt in notify stage", n: "POST", p: "notify"},
+	}
+	for _, tc := range spanTests {
+		tt := tc
+		t.Run(tt.d, func(t *testing.T) {
+			span, ok := spans[tt.n]
+			if !ok {
+				t.Fatalf("want span %q", tt.n)
+			}
+			if want, got := msg.SpanContext.TraceID(), span.SpanContext.TraceID(); want != got {
+				t.Errorf("want trace %v got %v", want, got)
+			}
+			if want, got := spans[tt.p].SpanContext.SpanID(), span.Parent.SpanID(); want != got {
+				t.Errorf("want parent %v got %v", want, got)
+			}
+		})
+	}
+
+	// the schedule stage ends when the message is emitted
+	if sched, notify := spans["schedule"], spans["notify"]; sched.EndTime.After(notify.StartTime) {
+		t.Errorf("want schedule stage to end before %v got %v", notify.StartTime, sched.EndTime)
+	}
+
+	// receivers see the attempt as parent
+	attempt := spans["POST"].SpanContext
+	want := "00-" + attempt.TraceID().String() + "-" + attempt.SpanID().String() + "-01"
+	if got := <-traceparent; want != got {
+		t.Errorf("want traceparent %q got %q", want, got)
+	}
+}
+
+func TestEndAll(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	// the message is held by a stage at shutdown
+	m := tracing.Start(message.Message{ID: "1", Body: "foo"}, "queue")
+	tracing.EndAll(errors.New("not sent"))
+	// the trace of an ended message is gone
+	tracing.End(m, nil)
+
+	spans := exp.GetSpans()
+	if want, got := 2, len(spans); want != got {
+		t.Fatalf("want %d spans got %d", want, got)
+	}
+	for _, span := range spans {
+		if span.Name != "message" {
+			continue
+		}
+		if want, got := codes.Error, span.Status.Code; want != got {
+			t.Errorf("want status %v got %v", want, got)
+		}
+	}
+}